@@ -2,146 +2,619 @@ package sonic
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stevecallear/sonic/pool"
+)
+
+type (
+	// Direction represents the direction of a logged line
+	Direction string
+
+	// LogEntry represents a logged command or response
+	LogEntry struct {
+		Direction   Direction
+		ChannelType string
+		Addr        string
+		Line        string
+	}
+)
+
+const (
+	// DirectionSent indicates a command sent to the server
+	DirectionSent Direction = "sent"
+
+	// DirectionReceived indicates a response received from the server
+	DirectionReceived Direction = "received"
 )
 
 type channel struct {
-	conn     net.Conn
-	reader   *bufio.Reader
-	logFn    func(string)
-	maxRunes int
+	conn         net.Conn
+	reader       *bufio.Reader
+	writer       *bufio.Writer
+	ctype        string
+	addr         string
+	logFn        func(string)
+	logger       func(LogEntry)
+	slog         *slog.Logger
+	sentAt       time.Time
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	deadline     time.Time
+	version      string
+	protocol     int
+	bufferSize   int
+	maxBytes     int
+	maxRunes     int
+	maxResponse  int
+	terminator   string
+	mu           *sync.Mutex
 }
 
 var (
-	// DialTCP connects to the specified server
-	DialTCP = func(addr string) (net.Conn, error) {
-		return net.Dial("tcp", addr)
+	// DialTCP connects to the specified server. If it is replaced then the
+	// replacement is used in place of DialTCPContext, but the dial is not
+	// bounded by the context or the connect timeout.
+	//
+	// Deprecated: use DialTCPContext or Options.Dialer.
+	DialTCP = dialTCP
+
+	// DialTCPContext connects to the specified server using the context
+	DialTCPContext = func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
 	}
 
 	// ErrInvalidResponse indicates that the received response message is invalid
 	ErrInvalidResponse = errors.New("invalid response")
 
-	bufferRegex = regexp.MustCompile(`^.+buffer\(([0-9]+)\)$`)
+	// ErrResponseTooLarge indicates that a response line exceeded the maximum
+	// response length
+	ErrResponseTooLarge = errors.New("response too large")
+
+	// ErrUnsupportedProtocol indicates that the server protocol version is
+	// lower than the configured minimum
+	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+
+	bufferRegex   = regexp.MustCompile(`^.+buffer\(([0-9]+)\)$`)
+	protocolRegex = regexp.MustCompile(`\bprotocol\(([0-9]+)\)`)
+	versionRegex  = regexp.MustCompile(`^CONNECTED <\S+ v?([^\s>]+)>$`)
 )
 
-func newChannel(ctype string, o Options) (*channel, error) {
-	conn, err := DialTCP(o.Addr)
+// newChannelRetry connects and starts a channel, retrying connection failures
+// up to the configured connect retries. The connect timeout bounds all attempts
+// together, including the backoff between them, rather than each attempt.
+func newChannelRetry(ctx context.Context, ctype string, o Options) (*channel, error) {
+	if o.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.ConnectTimeout)
+		defer cancel()
+	}
+
+	for n := 0; ; n++ {
+		c, err := newChannelContext(ctx, ctype, o)
+		if err == nil || n >= o.ConnectRetries || !pool.IsConnErr(err) || ctx.Err() != nil {
+			return c, err
+		}
+
+		if o.ConnectRetryBackoff > 0 {
+			t := time.NewTimer(o.ConnectRetryBackoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, err
+			}
+		}
+	}
+}
+
+// defaultDialer returns DialTCPContext, or DialTCP if it has been replaced so
+// that existing replacements continue to apply
+func defaultDialer() func(context.Context, string) (net.Conn, error) {
+	if reflect.ValueOf(DialTCP).Pointer() == reflect.ValueOf(dialTCP).Pointer() {
+		return DialTCPContext
+	}
+
+	dial := DialTCP
+	return func(_ context.Context, addr string) (net.Conn, error) {
+		return dial(addr)
+	}
+}
+
+func dialTCP(addr string) (net.Conn, error) {
+	return DialTCPContext(context.Background(), addr)
+}
+
+// newChannelContext connects and starts a channel, bounding both the dial and
+// the START handshake by the context
+func newChannelContext(ctx context.Context, ctype string, o Options) (*channel, error) {
+	dial := o.Dialer
+	if dial == nil {
+		dial = defaultDialer()
+	}
+
+	conn, err := dial(ctx, o.Addr)
 	if err != nil {
 		return nil, err
 	}
 
+	if tc, ok := conn.(*net.TCPConn); ok && o.KeepAlive > 0 {
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(o.KeepAlive)
+	}
+
+	if o.TLSConfig != nil {
+		conn = tls.Client(conn, tlsConfig(o))
+	}
+
 	close := func(err error) error {
 		conn.Close()
 		return err
 	}
 
+	rbs := o.ReadBufferSize
+	if rbs <= 0 {
+		rbs = DefaultReadBufferSize
+	}
+
 	c := &channel{
-		conn:   conn,
-		reader: bufio.NewReader(conn),
-		logFn:  o.LogFn,
+		conn:         conn,
+		reader:       bufio.NewReaderSize(conn, rbs),
+		writer:       bufio.NewWriter(fullWriter{conn}),
+		ctype:        ctype,
+		addr:         o.Addr,
+		logFn:        o.LogFn,
+		logger:       o.Logger,
+		readTimeout:  o.ReadTimeout,
+		writeTimeout: o.WriteTimeout,
+		maxResponse:  o.MaxResponseBytes,
+		terminator:   o.LineTerminator,
+		mu:           new(sync.Mutex),
+	}
+	if c.maxResponse <= 0 {
+		c.maxResponse = DefaultMaxResponseBytes
+	}
+	if c.terminator == "" {
+		c.terminator = DefaultLineTerminator
 	}
-	if c.logFn == nil {
-		c.logFn = func(string) {}
+	if o.SlogHandler != nil {
+		c.slog = slog.New(o.SlogHandler)
 	}
 
-	err = c.Write(fmt.Sprintf("START %s %s", ctype, o.Password))
+	if d, ok := ctx.Deadline(); ok {
+		c.SetDeadline(d)
+		defer c.SetDeadline(time.Time{})
+	}
+
+	// avoid logging the password in plaintext
+	err = c.write(fmt.Sprintf("START %s %s", ctype, o.Password), fmt.Sprintf("START %s <redacted>", ctype))
 	if err != nil {
 		return nil, close(err)
 	}
 
-	_, err = c.Read()
+	// CONNECTED <sonic-server v1.2.3>
+	res, err := c.Read()
 	if err != nil {
 		return nil, close(err)
 	}
 
-	res, err := c.Read()
+	c.version = parseVersion(res)
+
+	// STARTED search protocol(1) buffer(20000)
+	res, err = c.Read()
 	if err != nil {
+		// the server may end the connection if the start is rejected, for
+		// example ENDED authentication_failed
+		var ee *endedError
+		if errors.As(err, &ee) {
+			return nil, close(newSonicError(ee.reason))
+		}
 		return nil, close(err)
 	}
 
-	mr, err := parseMaxRunes(res)
+	b, err := parseBufferSize(res)
 	if err != nil {
 		return nil, close(err)
 	}
 
-	c.maxRunes = mr
+	c.protocol = parseProtocol(res)
+	if c.protocol < o.MinProtocol {
+		return nil, close(fmt.Errorf("%w: server protocol %d is lower than %d", ErrUnsupportedProtocol, c.protocol, o.MinProtocol))
+	}
+
+	c.bufferSize = b
+	c.maxBytes = maxBytes(b, o)
+	c.maxRunes = maxRunes(c.maxBytes)
+
+	// verify that the channel is usable before it is returned to the pool
+	if o.PingOnCreate {
+		if err := ping(c); err != nil {
+			return nil, close(err)
+		}
+	}
+
 	return c, nil
 }
 
+// Read flushes any buffered commands and reads the next response. Responses
+// may be terminated by either CRLF or LF, and the terminator is removed.
 func (c *channel) Read() (string, error) {
-	s, err := c.reader.ReadString('\n')
+	if err := c.Flush(); err != nil {
+		return "", err
+	}
+
+	if c.readTimeout > 0 {
+		c.mu.Lock()
+		err := c.conn.SetReadDeadline(c.timeout(c.readTimeout))
+		c.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	s, err := c.readLine()
 	if err != nil {
 		return "", err
 	}
 
 	if strings.HasPrefix(s, "ERR ") {
-		return "", errors.New(strings.TrimSpace(s[4:]))
+		return "", newSonicError(strings.TrimSpace(s[4:]))
+	}
+
+	c.log(DirectionReceived, s)
+
+	// the server may end the session at any point, for example on shutdown, so
+	// the channel must be discarded
+	if strings.HasPrefix(s, "ENDED ") {
+		return "", pool.Discard(&endedError{reason: strings.TrimPrefix(s, "ENDED ")})
 	}
 
-	s = strings.TrimSpace(s)
-	c.logFn(s)
 	return s, nil
 }
 
+// readLine reads the next line without the CRLF or LF terminator, discarding
+// the channel if the line exceeds the maximum response length so that an
+// unterminated response cannot exhaust memory
+func (c *channel) readLine() (string, error) {
+	var buf []byte
+	for {
+		b, err := c.reader.ReadSlice('\n')
+		if len(buf)+len(b) > c.maxResponse {
+			return "", pool.Discard(ErrResponseTooLarge)
+		}
+
+		if err == bufio.ErrBufferFull {
+			buf = append(buf, b...)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if buf != nil {
+			b = append(buf, b...)
+		}
+		return string(trimTerminator(b)), nil
+	}
+}
+
+// trimTerminator removes the LF line terminator and any preceding CR
+func trimTerminator(b []byte) []byte {
+	b = bytes.TrimSuffix(b, []byte{'\n'})
+	return bytes.TrimSuffix(b, []byte{'\r'})
+}
+
+// Write buffers the command, which is sent when the buffer is full, the
+// channel is flushed or the next response is read
 func (c *channel) Write(s string) error {
-	c.logFn(s)
-	_, err := c.conn.Write([]byte(s + "\r\n"))
+	return c.write(s, s)
+}
+
+func (c *channel) write(s, log string) error {
+	c.sentAt = time.Now()
+	c.log(DirectionSent, log)
+
+	if err := c.setWriteDeadline(); err != nil {
+		return err
+	}
+
+	if _, err := c.writer.WriteString(s); err != nil {
+		return err
+	}
+
+	_, err := c.writer.WriteString(c.terminator)
 	return err
 }
 
-func (c *channel) Close() error {
-	err := c.Write("QUIT")
-	if err != nil {
+// Flush sends any buffered commands
+func (c *channel) Flush() error {
+	if c.writer.Buffered() == 0 {
+		return nil
+	}
+
+	if err := c.setWriteDeadline(); err != nil {
 		return err
 	}
 
-	_, err = c.Read()
-	if err != nil {
+	return c.writer.Flush()
+}
+
+func (c *channel) setWriteDeadline() error {
+	if c.writeTimeout <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn.SetWriteDeadline(c.timeout(c.writeTimeout))
+}
+
+func (c *channel) log(d Direction, line string) {
+	if c.logFn != nil {
+		c.logFn(line)
+	}
+
+	if c.logger != nil {
+		c.logger(LogEntry{
+			Direction:   d,
+			ChannelType: c.ctype,
+			Addr:        c.addr,
+			Line:        line,
+		})
+	}
+
+	if c.slog != nil && c.slog.Enabled(context.Background(), slog.LevelDebug) {
+		attrs := []slog.Attr{
+			slog.String("direction", string(d)),
+			slog.String("channel_type", c.ctype),
+			slog.String("addr", c.addr),
+		}
+
+		// received lines include the time since the last command was sent
+		if d == DirectionReceived && !c.sentAt.IsZero() {
+			attrs = append(attrs, slog.Duration("latency", time.Since(c.sentAt)))
+		}
+
+		c.slog.LogAttrs(context.Background(), slog.LevelDebug, line, attrs...)
+	}
+}
+
+func (c *channel) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deadline = t
+	return c.conn.SetDeadline(t)
+}
+
+// timeout returns the deadline for an operation with the specified timeout,
+// or the channel deadline if it is earlier. The caller must hold the lock.
+func (c *channel) timeout(d time.Duration) time.Time {
+	t := time.Now().Add(d)
+	if !c.deadline.IsZero() && c.deadline.Before(t) {
+		return c.deadline
+	}
+
+	return t
+}
+
+// Close ends the session and closes the connection. The connection is closed
+// even if QUIT cannot be written or the ENDED response cannot be read, for
+// example if the deadline is exceeded.
+func (c *channel) Close() (err error) {
+	defer func() {
+		if cerr := c.conn.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if err := c.Write("QUIT"); err != nil {
 		return err
 	}
 
-	return c.conn.Close()
+	// ENDED quit
+	_, err = c.Read()
+	if errors.Is(err, ErrConnectionEnded) {
+		return nil
+	}
+	return err
 }
 
-func (c *channel) Split(s string) []string {
-	ss := []string{}
-	rs := []rune(s)
+// fullWriter writes the full buffer to the connection, retrying short writes
+type fullWriter struct {
+	conn net.Conn
+}
 
-	for i := 0; i < len(rs); i += c.maxRunes {
-		nn := i + c.maxRunes
-		if nn > len(rs) {
-			nn = len(rs)
+func (w fullWriter) Write(b []byte) (int, error) {
+	var n int
+	for n < len(b) {
+		m, err := w.conn.Write(b[n:])
+		n += m
+		if err != nil {
+			return n, err
 		}
-		ss = append(ss, string(rs[i:nn]))
 	}
 
+	return n, nil
+}
+
+// Split splits the text into chunks that, once escaped, fit within the server
+// buffer alongside the specified number of command overhead bytes. Chunks are
+// split on whitespace where possible, with longer tokens split at the limit.
+// Empty text results in an empty slice.
+func (c *channel) Split(s string, overhead int) []string {
+	max := c.maxBytes - overhead - len(c.terminator)
+
+	// escaping only increases the length, so the unescaped length gives the
+	// minimum number of chunks
+	var est int
+	if max > 0 {
+		est = (len(s) + max - 1) / max
+	}
+
+	ss := make([]string, 0, est)
+	c.SplitFunc(s, overhead, func(chunk string) error {
+		ss = append(ss, chunk)
+		return nil
+	})
+
 	return ss
 }
 
+// SplitFunc splits the text as Split would, calling fn with each chunk in turn
+// rather than holding every chunk at once. Splitting stops if fn returns an
+// error, which is returned.
+func (c *channel) SplitFunc(s string, overhead int, fn func(chunk string) error) error {
+	return splitFunc(s, c.maxBytes-overhead-len(c.terminator), fn)
+}
+
+// splitFunc calls fn with each chunk of the text that, once escaped, is at
+// most max bytes
+func splitFunc(s string, max int, fn func(chunk string) error) error {
+	var start, n int
+	var brk, brkN int // index and size following the last whitespace in the chunk
+
+	for i := 0; i < len(s); {
+		// ASCII bytes are looked up directly, avoiding rune decoding
+		var l, size int
+		var space bool
+		if b := s[i]; b < utf8.RuneSelf {
+			l, size, space = int(asciiLen[b]), 1, asciiSpace[b]
+		} else {
+			var r rune
+			r, size = utf8.DecodeRuneInString(s[i:])
+			l, space = escapedLen(r), unicode.IsSpace(r)
+		}
+
+		// cut the chunk at the last whitespace where possible
+		if n > 0 && n+l > max && brk > start && !space {
+			if err := fn(s[start:brk]); err != nil {
+				return err
+			}
+			start, n = brk, n-brkN
+		}
+
+		// the rune may still not fit once the chunk is cut at the whitespace,
+		// but at least one rune is included per chunk to guarantee progress
+		if n > 0 && n+l > max {
+			if err := fn(s[start:i]); err != nil {
+				return err
+			}
+			start, n = i, 0
+		}
+
+		n += l
+		i += size
+		if space {
+			brk, brkN = i, n
+		}
+	}
+
+	if start < len(s) {
+		return fn(s[start:])
+	}
+
+	return nil
+}
+
 func (c *channel) Escape(s string) string {
-	s = strings.Replace(s, "\\", "\\\\", -1)
-	s = strings.Replace(s, "\n", "\\n", -1)
-	s = strings.Replace(s, "\"", "\\\"", -1)
+	return Escape(s)
+}
+
+func tlsConfig(o Options) *tls.Config {
+	if o.TLSConfig.ServerName != "" || o.TLSConfig.InsecureSkipVerify {
+		return o.TLSConfig
+	}
 
-	return s
+	// default the server name to the host being dialled
+	host, _, err := net.SplitHostPort(o.Addr)
+	if err != nil {
+		host = o.Addr
+	}
+
+	c := o.TLSConfig.Clone()
+	c.ServerName = host
+	return c
 }
 
-func parseMaxRunes(msg string) (int, error) {
+func parseVersion(msg string) string {
+	m := versionRegex.FindStringSubmatch(msg)
+	if len(m) != 2 {
+		return ""
+	}
+
+	return m[1]
+}
+
+func parseProtocol(msg string) int {
+	m := protocolRegex.FindStringSubmatch(msg)
+	if len(m) != 2 {
+		return 0
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func parseBufferSize(msg string) (int, error) {
 	m := bufferRegex.FindStringSubmatch(msg)
 	if len(m) != 2 {
 		return 0, ErrInvalidResponse
 	}
 
-	b, err := strconv.Atoi(m[1])
-	if err != nil {
-		return 0, err
+	return strconv.Atoi(m[1])
+}
+
+func maxBytes(bufferSize int, o Options) int {
+	f := o.BufferSafetyFactor
+	if f <= 0 || f > 1 {
+		f = DefaultBufferSafetyFactor
+	}
+
+	// allow a fraction of the buffer for each command
+	return int(float64(bufferSize) * f)
+}
+
+func maxRunes(maxBytes int) int {
+	n := maxBytes / DefaultBytesPerRune
+	if n < 1 {
+		n = 1
 	}
 
-	// allow half of the buffer for text runes at 4 bytes each
-	return b / 2 / 4, nil
+	return n
+}
+
+// asciiLen and asciiSpace hold the escaped length and whitespace status of
+// each ASCII byte
+var asciiLen, asciiSpace = func() (l [utf8.RuneSelf]uint8, sp [utf8.RuneSelf]bool) {
+	for b := range l {
+		l[b] = uint8(escapedLen(rune(b)))
+		sp[b] = unicode.IsSpace(rune(b))
+	}
+	return l, sp
+}()
+
+func escapedLen(r rune) int {
+	switch r {
+	case '\\', '\n', '\r', '\t', '"':
+		return 2
+	default:
+		return utf8.RuneLen(r)
+	}
 }
@@ -1,14 +1,57 @@
 package sonic_test
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/pool"
+	"github.com/stevecallear/sonic/sonictest"
 )
 
+func TestDialTCP(t *testing.T) {
+	l := ServeLoopback(t, 20000)
+	defer l.Close()
+
+	conn, err := sonic.DialTCP(l.Addr().String())
+	AssertError(t, err, nil)
+	conn.Close()
+}
+
+func TestDialTCP_Replaced(t *testing.T) {
+	l := ServeLoopback(t, 20000)
+	defer l.Close()
+
+	var dialled bool
+	pfn := sonic.DialTCP
+	sonic.DialTCP = func(addr string) (net.Conn, error) {
+		dialled = true
+		return net.Dial("tcp", addr)
+	}
+	defer func() { sonic.DialTCP = pfn }()
+
+	c := sonic.NewSearch(sonic.Options{
+		Addr:     l.Addr().String(),
+		Password: "password",
+	})
+	defer c.Close()
+
+	AssertError(t, c.Ping(), nil)
+	if !dialled {
+		t.Error("expected the replaced dial func to be used")
+	}
+}
+
 func TestNewChannel(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -72,3 +115,1070 @@ func TestNewChannel(t *testing.T) {
 		})
 	}
 }
+
+func TestNewChannel_PingOnCreate(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Server)
+		exp   string
+		err   error
+	}{
+		{
+			name: "should return verification errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^PING$").Send("ERR PING")
+			},
+			err: errors.New("PING"),
+		},
+		{
+			name: "should return an error if the verification response is invalid",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^PING$").Send("OK")
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should verify the channel before use",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^PING$").Send("PONG")
+				s.On("^INFO$").Send("RESULT uptime(1)")
+			},
+			exp: "RESULT uptime(1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			tt.setup(s)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				c := sonic.NewControl(sonic.Options{
+					Password:     "password",
+					Dialer:       sonictest.Dialer(conn),
+					PingOnCreate: true,
+				})
+				defer c.Close()
+
+				res, err := c.Do("INFO")
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, res, tt.exp)
+			})
+		})
+	}
+}
+
+func TestNewChannel_MinProtocol(t *testing.T) {
+	tests := []struct {
+		name        string
+		banner      string
+		minProtocol int
+		err         error
+	}{
+		{
+			name:   "should accept any protocol by default",
+			banner: "STARTED control protocol(1) buffer(20000)",
+		},
+		{
+			name:        "should accept the minimum protocol",
+			banner:      "STARTED control protocol(2) buffer(20000)",
+			minProtocol: 2,
+		},
+		{
+			name:        "should return an error if the protocol is lower than the minimum",
+			banner:      "STARTED control protocol(1) buffer(20000)",
+			minProtocol: 2,
+			err:         sonic.ErrUnsupportedProtocol,
+		},
+		{
+			name:        "should return an error if the protocol is missing",
+			banner:      "STARTED control buffer(20000)",
+			minProtocol: 1,
+			err:         sonic.ErrUnsupportedProtocol,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			s.On(`^START control \w+$`).
+				Send("CONNECTED <sonic-server v1.4.9>").
+				Send(tt.banner)
+			if tt.err == nil {
+				s.On("^PING$").Send("PONG")
+			}
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				c := sonic.NewControl(sonic.Options{
+					Password:    "password",
+					Dialer:      sonictest.Dialer(conn),
+					MinProtocol: tt.minProtocol,
+				})
+				defer c.Close()
+
+				err := c.Ping()
+				AssertError(t, err, tt.err)
+			})
+		})
+	}
+}
+
+func TestNewChannel_LogFn(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("control", 20000)
+	s.On("^PING$").Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		logs := []string{}
+		c := sonic.NewControl(sonic.Options{
+			Password: "secret",
+			LogFn: func(s string) {
+				logs = append(logs, s)
+			},
+		})
+
+		err := c.Ping()
+		AssertError(t, err, nil)
+
+		for _, l := range logs {
+			if strings.Contains(l, "secret") {
+				t.Errorf("password logged: %s", l)
+			}
+		}
+
+		AssertDeepEqual(t, logs[0], "START control <redacted>")
+	})
+}
+
+func TestNewChannel_Logger(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("control", 20000)
+	s.On("^PING$").Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		logs := []sonic.LogEntry{}
+		c := sonic.NewControl(sonic.Options{
+			Addr:     "localhost:1491",
+			Password: "secret",
+			Dialer:   sonictest.Dialer(conn),
+			Logger: func(e sonic.LogEntry) {
+				logs = append(logs, e)
+			},
+		})
+
+		err := c.Ping()
+		AssertError(t, err, nil)
+
+		entry := func(d sonic.Direction, line string) sonic.LogEntry {
+			return sonic.LogEntry{
+				Direction:   d,
+				ChannelType: "control",
+				Addr:        "localhost:1491",
+				Line:        line,
+			}
+		}
+
+		AssertDeepEqual(t, logs, []sonic.LogEntry{
+			entry(sonic.DirectionSent, "START control <redacted>"),
+			entry(sonic.DirectionReceived, "CONNECTED <sonic-server v1.2.3>"),
+			entry(sonic.DirectionReceived, "STARTED search protocol(1) buffer(20000)"),
+			entry(sonic.DirectionSent, "PING"),
+			entry(sonic.DirectionReceived, "PONG"),
+		})
+	})
+}
+
+type recordHandler struct {
+	records *[]slog.Record
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h recordHandler) WithGroup(string) slog.Handler { return h }
+
+func TestNewChannel_SlogHandler(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("search", 20000)
+	s.On("^PING$").Delay(10 * time.Millisecond).Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		records := []slog.Record{}
+		c := sonic.NewSearch(sonic.Options{
+			Addr:        "localhost:1491",
+			Password:    "secret",
+			Dialer:      sonictest.Dialer(conn),
+			SlogHandler: recordHandler{records: &records},
+		})
+
+		err := c.Ping()
+		AssertError(t, err, nil)
+
+		if len(records) != 5 {
+			t.Fatalf("got %d records, expected 5", len(records))
+		}
+
+		for i, exp := range []struct {
+			msg       string
+			direction string
+		}{
+			{"START search <redacted>", "sent"},
+			{"CONNECTED <sonic-server v1.2.3>", "received"},
+			{"STARTED search protocol(1) buffer(20000)", "received"},
+			{"PING", "sent"},
+			{"PONG", "received"},
+		} {
+			r := records[i]
+			AssertEqual(t, r.Level, slog.LevelDebug)
+			AssertEqual(t, r.Message, exp.msg)
+
+			attrs := map[string]slog.Value{}
+			r.Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value
+				return true
+			})
+
+			AssertEqual(t, attrs["direction"].String(), exp.direction)
+			AssertEqual(t, attrs["channel_type"].String(), "search")
+			AssertEqual(t, attrs["addr"].String(), "localhost:1491")
+
+			latency, ok := attrs["latency"]
+			if ok != (exp.direction == "received") {
+				t.Errorf("got latency %v for %s, expected latency for received records", latency, exp.msg)
+			}
+		}
+
+		records[4].Attrs(func(a slog.Attr) bool {
+			if a.Key == "latency" && a.Value.Duration() < 10*time.Millisecond {
+				t.Errorf("got %v, expected at least 10ms", a.Value.Duration())
+			}
+			return true
+		})
+	})
+}
+
+type shortWriteConn struct {
+	net.Conn
+	max int
+}
+
+func (c *shortWriteConn) Write(b []byte) (int, error) {
+	if len(b) > c.max {
+		b = b[:c.max]
+	}
+	return c.Conn.Write(b)
+}
+
+func TestChannel_Write(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("ingest", 20000)
+	s.On(`^PUSH collection bucket object "a longer piece of text"$`).Send("OK")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return &shortWriteConn{Conn: conn, max: 3}, nil
+		})
+		defer restore()
+
+		i := sonic.NewIngest(sonic.Options{
+			Password: "password",
+		})
+		defer i.Close()
+
+		err := i.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "a longer piece of text",
+		})
+		AssertError(t, err, nil)
+	})
+}
+
+type failingConn struct {
+	net.Conn
+	fail   atomic.Bool
+	closed atomic.Bool
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	if c.fail.Load() {
+		return 0, errWrite
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *failingConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+var errWrite = &net.OpError{Op: "write", Net: "tcp", Err: errors.New("broken pipe")}
+
+func TestChannel_Close(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("control", 20000)
+	s.On("^PING$").Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		fc := &failingConn{Conn: conn}
+
+		c := sonic.NewControl(sonic.Options{
+			Password: "password",
+			Dialer:   sonictest.Dialer(fc),
+		})
+		defer c.Close()
+
+		AssertError(t, c.Ping(), nil)
+
+		// the failed write is retained by the channel writer, so the QUIT
+		// write also fails when the broken channel is removed
+		fc.fail.Store(true)
+		AssertError(t, c.Ping(), errWrite)
+		AssertEqual(t, fc.closed.Load(), true)
+	})
+}
+
+func TestChannel_MaxResponseBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		response string
+		err      error
+	}{
+		{
+			name:     "should read responses within the limit",
+			maxBytes: 64,
+			response: strings.Repeat("a", 62), // 64 bytes including the terminator
+		},
+		{
+			name:     "should return an error if the response exceeds the limit",
+			maxBytes: 64,
+			response: strings.Repeat("a", 63),
+			err:      sonic.ErrResponseTooLarge,
+		},
+		{
+			name:     "should return an error if the response exceeds the read buffer",
+			maxBytes: 8192,
+			response: strings.Repeat("a", 8192),
+			err:      sonic.ErrResponseTooLarge,
+		},
+		{
+			name:     "should read responses larger than the read buffer",
+			response: strings.Repeat("a", 8192),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			s.ConfigureStart("control", 20000)
+			s.On("^INFO$").Send(tt.response)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				c := sonic.NewControl(sonic.Options{
+					Password:         "password",
+					Dialer:           sonictest.Dialer(conn),
+					MaxResponseBytes: tt.maxBytes,
+				})
+				defer c.Close()
+
+				res, err := c.Do("INFO")
+				AssertError(t, err, tt.err)
+
+				if tt.err == nil {
+					AssertDeepEqual(t, res, tt.response)
+				} else {
+					AssertDeepEqual(t, c.PoolStats(), pool.Stats{MaxSize: 1})
+				}
+			})
+		})
+	}
+}
+
+type oneByteConn struct {
+	net.Conn
+}
+
+func (c *oneByteConn) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return c.Conn.Read(b)
+}
+
+func TestChannel_Read(t *testing.T) {
+	tests := []struct {
+		name        string
+		terminators []string
+		oneByte     bool
+	}{
+		{
+			name:        "should read CRLF terminated responses",
+			terminators: []string{"\r\n"},
+		},
+		{
+			name:        "should read LF terminated responses",
+			terminators: []string{"\n"},
+		},
+		{
+			name:        "should read mixed terminators",
+			terminators: []string{"\n", "\r\n"},
+		},
+		{
+			name:        "should reassemble responses read one byte at a time",
+			terminators: []string{"\r\n"},
+			oneByte:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			go func() {
+				var n int
+				send := func(s string) {
+					server.Write([]byte(s + tt.terminators[n%len(tt.terminators)]))
+					n++
+				}
+
+				r := bufio.NewReader(server)
+				for {
+					s, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					switch {
+					case strings.HasPrefix(s, "START"):
+						send("CONNECTED <sonic-server v1.2.3>")
+						send("STARTED control protocol(1) buffer(20000)")
+					case strings.HasPrefix(s, "INFO"):
+						send("RESULT uptime(1) queries(2)")
+					case strings.HasPrefix(s, "QUIT"):
+						send("ENDED quit")
+					}
+				}
+			}()
+
+			var conn net.Conn = client
+			if tt.oneByte {
+				conn = &oneByteConn{Conn: client}
+			}
+
+			c := sonic.NewControl(sonic.Options{
+				Password: "password",
+				Dialer:   sonictest.Dialer(conn),
+			})
+
+			res, err := c.Do("INFO")
+			AssertError(t, err, nil)
+			AssertDeepEqual(t, res, "RESULT uptime(1) queries(2)")
+			AssertDeepEqual(t, c.ServerVersion(), "1.2.3")
+			AssertEqual(t, c.BufferSize(), 20000)
+
+			AssertError(t, c.Close(), nil)
+		})
+	}
+}
+
+func TestChannel_LineTerminator(t *testing.T) {
+	tests := []struct {
+		name       string
+		terminator string
+		exp        []string
+	}{
+		{
+			name: "should terminate commands with CRLF by default",
+			exp:  []string{"START control password\r\n", "PING\r\n", "QUIT\r\n"},
+		},
+		{
+			name:       "should terminate commands with the specified terminator",
+			terminator: "\n",
+			exp:        []string{"START control password\n", "PING\n", "QUIT\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			lines := make(chan []string)
+			go func() {
+				var ls []string
+				defer func() { lines <- ls }()
+
+				r := bufio.NewReader(server)
+				for {
+					s, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					ls = append(ls, s)
+
+					switch {
+					case strings.HasPrefix(s, "START"):
+						server.Write([]byte("CONNECTED <sonic-server v1.2.3>\r\n"))
+						server.Write([]byte("STARTED control protocol(1) buffer(20000)\r\n"))
+					case strings.HasPrefix(s, "PING"):
+						server.Write([]byte("PONG\r\n"))
+					case strings.HasPrefix(s, "QUIT"):
+						server.Write([]byte("ENDED quit\r\n"))
+					}
+				}
+			}()
+
+			c := sonic.NewControl(sonic.Options{
+				Password:       "password",
+				Dialer:         sonictest.Dialer(client),
+				LineTerminator: tt.terminator,
+			})
+
+			AssertError(t, c.Ping(), nil)
+			AssertError(t, c.Close(), nil)
+			AssertDeepEqual(t, <-lines, tt.exp)
+		})
+	}
+}
+
+func TestNewChannel_Addr(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		exp  string
+	}{
+		{
+			name: "should use the default address if not specified",
+			exp:  sonic.DefaultAddr,
+		},
+		{
+			name: "should use the specified address",
+			addr: "sonic:1491",
+			exp:  "sonic:1491",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var act string
+			restore := SetDialTCP(func(addr string) (net.Conn, error) {
+				act = addr
+				return nil, ErrConnect
+			})
+			defer restore()
+
+			c := sonic.NewControl(sonic.Options{
+				Addr:     tt.addr,
+				Password: "password",
+			})
+
+			err := c.Ping()
+			AssertError(t, err, ErrConnect)
+			AssertDeepEqual(t, act, tt.exp)
+		})
+	}
+}
+
+func TestNewChannel_TLS(t *testing.T) {
+	s, config := NewTLSServer(t, "localhost")
+	s.ConfigureStart("control", 20000)
+	s.On("^PING$").Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		c := sonic.NewControl(sonic.Options{
+			Addr:      "localhost:1491",
+			Password:  "password",
+			TLSConfig: config,
+		})
+		defer c.Close()
+
+		err := c.Ping()
+		AssertError(t, err, nil)
+	})
+}
+
+func TestNewChannel_Dialer(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("control", 20000)
+	s.On("^PING$").Send("PONG")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return nil, ErrConnect
+		})
+		defer restore()
+
+		var act string
+		c := sonic.NewControl(sonic.Options{
+			Addr:     "sonic:1491",
+			Password: "password",
+			Dialer: func(_ context.Context, addr string) (net.Conn, error) {
+				act = addr
+				return conn, nil
+			},
+		})
+		defer c.Close()
+
+		err := c.Ping()
+		AssertError(t, err, nil)
+		AssertDeepEqual(t, act, "sonic:1491")
+	})
+}
+
+func TestNewChannel_ConnectTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		dialer func(context.Context, string) (net.Conn, error)
+	}{
+		{
+			name: "should time out dialling an unroutable address",
+		},
+		{
+			name: "should time out the start handshake",
+			dialer: func(context.Context, string) (net.Conn, error) {
+				c, _ := net.Pipe() // never responds
+				return c, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := 100 * time.Millisecond
+
+			c := sonic.NewControl(sonic.Options{
+				Addr:           "10.255.255.1:1491",
+				Password:       "password",
+				ConnectTimeout: timeout,
+				Dialer:         tt.dialer,
+			})
+
+			start := time.Now()
+			err := c.Ping()
+			if err == nil {
+				t.Errorf("got nil, expected an error")
+			}
+
+			if d := time.Since(start); d > 10*timeout {
+				t.Errorf("got %v, expected less than %v", d, 10*timeout)
+			}
+		})
+	}
+}
+
+func TestNewChannel_ConnectRetries(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		name    string
+		retries int
+		errs    []error
+		dials   int
+		err     error
+	}{
+		{
+			name:    "should retry connection errors",
+			retries: 1,
+			errs:    []error{refused},
+			dials:   2,
+		},
+		{
+			name:  "should not retry by default",
+			errs:  []error{refused},
+			dials: 1,
+			err:   refused,
+		},
+		{
+			name:    "should return the error once the retries are exhausted",
+			retries: 1,
+			errs:    []error{refused, refused},
+			dials:   2,
+			err:     refused,
+		},
+		{
+			name:    "should not retry other errors",
+			retries: 1,
+			errs:    []error{ErrConnect},
+			dials:   1,
+			err:     ErrConnect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if tt.err == nil {
+				s.ConfigureStart("control", 20000)
+				s.On("^PING$").Send("PONG")
+			}
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				var dials int
+				c := sonic.NewControl(sonic.Options{
+					Password:       "password",
+					ConnectRetries: tt.retries,
+					Dialer: func(context.Context, string) (net.Conn, error) {
+						if dials++; dials <= len(tt.errs) {
+							return nil, tt.errs[dials-1]
+						}
+						return conn, nil
+					},
+				})
+				defer c.Close()
+
+				AssertError(t, c.Ping(), tt.err)
+				AssertEqual(t, dials, tt.dials)
+			})
+		})
+	}
+
+	t.Run("should bound the retries by the connect timeout", func(t *testing.T) {
+		var dials int
+		c := sonic.NewControl(sonic.Options{
+			Password:            "password",
+			ConnectTimeout:      100 * time.Millisecond,
+			ConnectRetries:      100,
+			ConnectRetryBackoff: 30 * time.Millisecond,
+			Dialer: func(context.Context, string) (net.Conn, error) {
+				dials++
+				return nil, refused
+			},
+		})
+		defer c.Close()
+
+		start := time.Now()
+		AssertError(t, c.Ping(), refused)
+
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("got %v, expected the connect timeout to bound the retries", d)
+		}
+
+		if dials > 5 {
+			t.Errorf("got %d dials, expected the connect timeout to bound the retries", dials)
+		}
+	})
+}
+
+func TestNewChannel_Context(t *testing.T) {
+	// accept connections without ever sending the CONNECTED banner
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		var conns []net.Conn
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+
+	tests := []struct {
+		name           string
+		connectTimeout time.Duration
+		ctxTimeout     time.Duration
+	}{
+		{
+			name:       "should bound the handshake by the context",
+			ctxTimeout: 100 * time.Millisecond,
+		},
+		{
+			name:           "should bound the handshake by the connect timeout",
+			connectTimeout: 100 * time.Millisecond,
+			ctxTimeout:     time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := sonic.NewClient(sonic.Options{
+				Addr:           l.Addr().String(),
+				Password:       "password",
+				ConnectTimeout: tt.connectTimeout,
+			})
+			defer c.Close()
+			c.Control()
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.ctxTimeout)
+			defer cancel()
+
+			start := time.Now()
+			n, err := c.WarmUp(ctx, 1)
+			if err == nil {
+				t.Errorf("got nil, expected an error")
+			}
+			AssertEqual(t, n, 0)
+
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("got %v, expected the handshake to time out", d)
+			}
+		})
+	}
+}
+
+func TestNewChannel_Unauthorized(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Server)
+	}{
+		{
+			name: "should return an error if the start is rejected",
+			setup: func(s *Server) {
+				s.On(`^START control \w+$`).
+					Send("CONNECTED <sonic-server v1.2.3>").
+					Send("ERR authentication_failed")
+			},
+		},
+		{
+			name: "should return an error if the start is ended",
+			setup: func(s *Server) {
+				s.On(`^START control \w+$`).
+					Send("CONNECTED <sonic-server v1.2.3>").
+					Send("ENDED authentication_failed")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			tt.setup(s)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				c := sonic.NewControl(sonic.Options{
+					Password: "invalid",
+				})
+
+				err := c.Ping()
+				if !errors.Is(err, sonic.ErrUnauthorized) {
+					t.Errorf("got %v, expected %v", err, sonic.ErrUnauthorized)
+				}
+			})
+		})
+	}
+}
+
+func TestChannel_Timeouts(t *testing.T) {
+	t.Run("should time out blocked reads", func(t *testing.T) {
+		s := NewServer()
+		s.ConfigureStart("control", 20000)
+		s.On("^PING$").Delay(100 * time.Millisecond).Send("PONG")
+
+		s.Run(t, func(t *testing.T, conn net.Conn) {
+			c := sonic.NewControl(sonic.Options{
+				Password:    "password",
+				Dialer:      sonictest.Dialer(conn),
+				ReadTimeout: 10 * time.Millisecond,
+			})
+
+			assertTimeout(t, c.Ping())
+		})
+	})
+
+	t.Run("should time out blocked writes", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		// complete the handshake, then stop reading
+		go func() {
+			r := bufio.NewReader(server)
+			r.ReadString('\n')
+			server.Write([]byte("CONNECTED <sonic-server v1.2.3>\r\n"))
+			server.Write([]byte("STARTED control protocol(1) buffer(20000)\r\n"))
+		}()
+
+		c := sonic.NewControl(sonic.Options{
+			Password:     "password",
+			Dialer:       sonictest.Dialer(client),
+			WriteTimeout: 10 * time.Millisecond,
+		})
+
+		assertTimeout(t, c.Ping())
+	})
+}
+
+func assertTimeout(t *testing.T, err error) {
+	t.Helper()
+
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("got %v, expected a timeout error", err)
+	}
+}
+
+func TestChannel_Split(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxBytes int
+		chunks   int
+	}{
+		{
+			name:     "should split ascii text on whitespace",
+			text:     "the quick brown fox jumps over the lazy dog",
+			maxBytes: 14,
+			chunks:   4,
+		},
+		{
+			name:     "should split cjk text by rune",
+			text:     "日本語のテキストを分割する",
+			maxBytes: 11,
+			chunks:   5,
+		},
+		{
+			name:     "should split mixed text",
+			text:     "ascii 混合テキスト \"quoted\"\n",
+			maxBytes: 12,
+			chunks:   5,
+		},
+		{
+			name:     "should split text with tabs and carriage returns",
+			text:     "tab\tseparated\r\nvalues",
+			maxBytes: 12,
+			chunks:   3,
+		},
+		{
+			name:     "should split a multibyte rune that follows a whitespace break",
+			text:     "a bcd€",
+			maxBytes: 7,
+			chunks:   3,
+		},
+		{
+			name:     "should split cjk text that follows a whitespace break",
+			text:     "a bcd日本",
+			maxBytes: 7,
+			chunks:   4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act := sonic.Split(tt.maxBytes, tt.text, 0)
+
+			max := tt.maxBytes - len("\r\n")
+			for _, c := range act {
+				if !utf8.ValidString(c) {
+					t.Errorf("got invalid chunk %q", c)
+				}
+				if n := len(sonic.Escape(c)); n > max {
+					t.Errorf("got %d bytes, expected at most %d", n, max)
+				}
+			}
+
+			AssertEqual(t, len(act), tt.chunks)
+			AssertEqual(t, strings.Join(act, ""), tt.text)
+		})
+	}
+}
+
+func TestChannel_SplitFunc(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxBytes int
+	}{
+		{
+			name:     "should split ascii text on whitespace",
+			text:     "the quick brown fox jumps over the lazy dog",
+			maxBytes: 14,
+		},
+		{
+			name:     "should split cjk text by rune",
+			text:     "日本語のテキストを分割する",
+			maxBytes: 11,
+		},
+		{
+			name:     "should split mixed text",
+			text:     "ascii 混合テキスト \"quoted\"\n",
+			maxBytes: 12,
+		},
+		{
+			name:     "should split text with tabs and carriage returns",
+			text:     "tab\tseparated\r\nvalues",
+			maxBytes: 12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var act []string
+			err := sonic.SplitFunc(tt.maxBytes, tt.text, 0, func(c string) error {
+				act = append(act, c)
+				return nil
+			})
+
+			AssertError(t, err, nil)
+			AssertDeepEqual(t, act, sonic.Split(tt.maxBytes, tt.text, 0))
+		})
+	}
+
+	t.Run("should stop on error", func(t *testing.T) {
+		exp := errors.New("error")
+
+		var n int
+		err := sonic.SplitFunc(14, "the quick brown fox jumps over the lazy dog", 0, func(string) error {
+			n++
+			return exp
+		})
+
+		AssertError(t, err, exp)
+		AssertEqual(t, n, 1)
+	})
+}
+
+func BenchmarkChannel_Split(b *testing.B) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 25000) // ~1MB
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+
+	for n := 0; n < b.N; n++ {
+		sonic.Split(10000, text, 64)
+	}
+}
+
+func BenchmarkChannel_Split_Chunks(b *testing.B) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 2500) // ~100KB
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+
+	for n := 0; n < b.N; n++ {
+		sonic.Split(256, text, 64)
+	}
+}
@@ -1,50 +1,735 @@
 package sonic
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/stevecallear/sonic/pool"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
 	// Options represents a set of client options
 	Options struct {
-		Addr        string
-		Password    string
-		PoolSize    int
-		PoolTimeout time.Duration
-		LogFn       func(string)
+		Addr                  string
+		Addrs                 []string // optional, takes precedence over Addr
+		Password              string
+		PoolSize              int
+		PoolMinIdle           int           // optional, channels opened by WarmUp
+		PoolTimeout           time.Duration // optional, wait for an available connection, excluding connect time
+		PoolMaxIdleTime       time.Duration // optional, idle channels are pinged before reuse
+		PoolIdleTimeout       time.Duration // optional, idle channels are replaced before reuse without a ping
+		PoolMaxLifetime       time.Duration // optional, older channels are replaced before reuse
+		PoolLIFO              bool          // optional, reuses the most recently used channel first
+		KeepAlivePingInterval time.Duration // optional, idle channels are pinged in the background
+		PingTimeout           time.Duration // optional, bounds each validation ping, defaults to DefaultPingTimeout
+		ConnectTimeout        time.Duration // optional, bounds the dial and START handshake for each address, across all retries
+		ConnectRetries        int           // optional, retries of the dial and START handshake on connection errors
+		ConnectRetryBackoff   time.Duration // optional, delay between connect retries
+		KeepAlive             time.Duration // optional, TCP keep-alive period
+		ReadTimeout           time.Duration // optional, deadline for each read
+		WriteTimeout          time.Duration // optional, deadline for each write
+		MaxRetries            int           // optional, retries on connection errors
+		RetryBackoff          time.Duration // optional, delay between retries
+		ReconnectBackoff      time.Duration // optional, initial delay after a connection failure
+		ReconnectMaxDelay     time.Duration // optional, maximum delay after connection failures
+		CircuitThreshold      int           // optional, consecutive connection failures that open the circuit
+		CircuitCooldown       time.Duration // optional, time before an open circuit allows a probe request
+		BufferSafetyFactor    float64       // optional, defaults to DefaultBufferSafetyFactor
+		MaxResponseBytes      int           // optional, defaults to DefaultMaxResponseBytes
+		ReadBufferSize        int           // optional, defaults to DefaultReadBufferSize
+		LineTerminator        string        // optional, defaults to DefaultLineTerminator
+		ValidateUTF8          bool          // optional, rejects pushed text that is not valid UTF-8
+		PingOnCreate          bool          // optional, verifies new channels with a PING after START
+		MinProtocol           int           // optional, minimum protocol version accepted from the server
+		LogFn                 func(string)
+		Logger                func(LogEntry)                                           // optional, receives structured log entries
+		SlogHandler           slog.Handler                                             // optional, receives debug log records
+		TracerProvider        trace.TracerProvider                                     // optional, defaults to the global provider
+		OnCommand             func(cmd string, d time.Duration, err error)             // optional, called when each command completes
+		OnAcquire             func(pool.Channel)                                       // optional, called when a pooled channel is acquired
+		OnRelease             func(pool.Channel, error)                                // optional, called when a pooled channel is released
+		OnNew                 func(pool.Channel)                                       // optional, called when a pooled channel is created
+		OnRemove              func(pool.Channel)                                       // optional, called when a pooled channel is closed and removed
+		OnReconnect           func(failures int)                                       // optional, called when a channel is created following failures
+		PoolAcquireMode       pool.AcquireMode                                         // optional, defaults to blocking until a channel is available
+		TLSConfig             *tls.Config                                              // optional
+		Dialer                func(ctx context.Context, addr string) (net.Conn, error) // optional, defaults to DialTCPContext
+	}
+
+	// Client represents a client for all channel types, with each channel type
+	// client created on first use
+	Client struct {
+		options Options
+		ingest  *Ingest
+		search  *Search
+		control *Control
+		mu      *sync.Mutex
 	}
 
 	client struct {
-		pool *pool.Pool
+		pool      *pool.Pool
+		tracer    trace.Tracer
+		onCommand func(cmd string, d time.Duration, err error)
 	}
 )
 
+const (
+	// DefaultAddr is the default Sonic server address
+	DefaultAddr = "127.0.0.1:1491"
+
+	// DefaultPingTimeout is the default deadline for pings that validate pooled channels
+	DefaultPingTimeout = 5 * time.Second
+
+	// DefaultBytesPerRune is the number of bytes assumed per text rune
+	// when estimating MaxTextRunes
+	DefaultBytesPerRune = 4
+
+	// DefaultBufferSafetyFactor is the default fraction of the server buffer used for text
+	DefaultBufferSafetyFactor = 0.5
+
+	// DefaultMaxResponseBytes is the default maximum length of a response line
+	DefaultMaxResponseBytes = 4 << 20
+
+	// DefaultReadBufferSize is the default size of the connection read buffer
+	DefaultReadBufferSize = 4096
+
+	// DefaultLineTerminator is the default terminator written after each command
+	DefaultLineTerminator = "\r\n"
+)
+
+var (
+	// ErrInvalidIdentifier indicates that a collection, bucket or object identifier
+	// contains whitespace, control or quote characters, or that a required
+	// identifier is empty
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+
+	// ErrInvalidCommand indicates that a raw command is empty or contains line breaks
+	ErrInvalidCommand = errors.New("invalid command")
+
+	helpRegexp = regexp.MustCompile(`^RESULT \w+\(([^)]*)\)$`)
+)
+
+// WithOperationTimeout returns a copy of the context that bounds a single
+// operation using a method that accepts a context, such as QueryContext or
+// PushContext. The timeout overrides Options.PoolTimeout when waiting for a
+// pooled connection and is applied as the connection deadline.
+func WithOperationTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return pool.WithTimeout(ctx, d), cancel
+}
+
+// NewClient returns a new client for all channel types
+func NewClient(o Options) *Client {
+	return &Client{
+		options: o,
+		mu:      new(sync.Mutex),
+	}
+}
+
+// Ingest returns the ingest client
+func (c *Client) Ingest() *Ingest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ingest == nil {
+		c.ingest = NewIngest(c.options)
+	}
+
+	return c.ingest
+}
+
+// Search returns the search client
+func (c *Client) Search() *Search {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.search == nil {
+		c.search = NewSearch(c.options)
+	}
+
+	return c.search
+}
+
+// Control returns the control client
+func (c *Client) Control() *Control {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.control == nil {
+		c.control = NewControl(c.options)
+	}
+
+	return c.control
+}
+
+// HealthCheck checks the connections of each client that has been created,
+// returning any errors
+func (c *Client) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, cl := range c.clients() {
+		errs = append(errs, cl.HealthCheck(ctx))
+	}
+
+	return errors.Join(errs...)
+}
+
+// WarmUp attempts to open n connections for each client that has been
+// created, returning the total number opened and any errors. Connections that
+// were opened remain in the pool if others fail.
+func (c *Client) WarmUp(ctx context.Context, n int) (int, error) {
+	var total int
+	var errs []error
+	for _, cl := range c.clients() {
+		m, err := cl.WarmUpN(ctx, n)
+		total += m
+		errs = append(errs, err)
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// Close closes each client that has been created, returning any errors
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	if c.ingest != nil {
+		errs = append(errs, c.ingest.Close())
+	}
+	if c.search != nil {
+		errs = append(errs, c.search.Close())
+	}
+	if c.control != nil {
+		errs = append(errs, c.control.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// CloseContext closes each client that has been created before the context is
+// done, returning any errors
+func (c *Client) CloseContext(ctx context.Context) error {
+	cs := c.clients()
+	errs := make([]error, len(cs))
+
+	var wg sync.WaitGroup
+	for n, cl := range cs {
+		wg.Add(1)
+		go func(n int, cl *client) {
+			defer wg.Done()
+			errs[n] = cl.CloseContext(ctx)
+		}(n, cl)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts down each client that has been created, waiting for in-flight
+// commands to complete or the context to be done, and returning any errors
+func (c *Client) Shutdown(ctx context.Context) error {
+	cs := c.clients()
+	errs := make([]error, len(cs))
+
+	var wg sync.WaitGroup
+	for n, cl := range cs {
+		wg.Add(1)
+		go func(n int, cl *client) {
+			defer wg.Done()
+			errs[n] = cl.Shutdown(ctx)
+		}(n, cl)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// clients returns each client that has been created
+func (c *Client) clients() []*client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var cs []*client
+	if c.ingest != nil {
+		cs = append(cs, c.ingest.client)
+	}
+	if c.search != nil {
+		cs = append(cs, c.search.client)
+	}
+	if c.control != nil {
+		cs = append(cs, c.control.client)
+	}
+
+	return cs
+}
+
 func newClient(ctype string, o Options) *client {
+	addrs := o.Addrs
+	if len(addrs) == 0 {
+		if o.Addr == "" {
+			o.Addr = DefaultAddr
+		}
+		addrs = []string{o.Addr}
+	}
+	if o.PingTimeout <= 0 {
+		o.PingTimeout = DefaultPingTimeout
+	}
+
+	var next uint32
 	return &client{
+		tracer:    newTracer(o),
+		onCommand: o.OnCommand,
 		pool: pool.New(pool.Options{
-			NewFn: func() (pool.Channel, error) {
-				return newChannel(ctype, o)
+			NewContextFn: func(ctx context.Context) (pool.Channel, error) {
+				// start from the next address in turn to distribute channels,
+				// falling back to the remaining addresses on failure
+				start := int(atomic.AddUint32(&next, 1) - 1)
+
+				var err error
+				for n := range addrs {
+					co := o
+					co.Addr = addrs[(start+n)%len(addrs)]
+
+					var ch *channel
+					if ch, err = newChannelRetry(ctx, ctype, co); err == nil {
+						return ch, nil
+					}
+				}
+
+				return nil, err
+			},
+			Size:         o.PoolSize,
+			MinIdle:      o.PoolMinIdle,
+			Timeout:      o.PoolTimeout,
+			MaxIdleTime:  o.PoolMaxIdleTime,
+			IdleTimeout:  o.PoolIdleTimeout,
+			MaxLifetime:  o.PoolMaxLifetime,
+			LIFO:         o.PoolLIFO,
+			AcquireMode:  o.PoolAcquireMode,
+			MaxRetries:   o.MaxRetries,
+			Backoff:      o.RetryBackoff,
+			NewBackoff:   o.ReconnectBackoff,
+			NewMaxDelay:  o.ReconnectMaxDelay,
+			Threshold:    o.CircuitThreshold,
+			Cooldown:     o.CircuitCooldown,
+			PingInterval: o.KeepAlivePingInterval,
+			OnAcquire:    o.OnAcquire,
+			OnRelease:    o.OnRelease,
+			OnNew:        o.OnNew,
+			OnRemove:     o.OnRemove,
+			OnReconnect:  o.OnReconnect,
+			ValidateContext: func(ctx context.Context, ch pool.Channel) bool {
+				return validate(ctx, ch, o.PingTimeout) == nil
 			},
-			Size:    o.PoolSize,
-			Timeout: o.PoolTimeout,
 		}),
 	}
 }
 
 func (c *client) Ping() error {
-	return c.pool.Exec(func(ch pool.Channel) error {
-		err := ch.Write("PING")
-		if err != nil {
+	return c.PingContext(context.Background())
+}
+
+// PingContext pings the server using the specified context
+func (c *client) PingContext(ctx context.Context) (err error) {
+	ctx, op := c.start(ctx, "PING", "", "")
+	defer func() { op.end(err) }()
+
+	err = c.pool.ExecContext(ctx, func(ch pool.Channel) error {
+		_, err := withContext(ctx, ch, func() (interface{}, error) {
+			return nil, ping(ch)
+		})
+		return err
+	})
+
+	return contextErr(ctx, err)
+}
+
+// PingLatency pings the server, returning the round trip time
+func (c *client) PingLatency() (d time.Duration, err error) {
+	_, op := c.start(context.Background(), "PING", "", "")
+	defer func() { op.end(err) }()
+
+	err = c.pool.Exec(func(ch pool.Channel) error {
+		start := time.Now()
+		if err := ping(ch); err != nil {
 			return err
 		}
 
-		_, err = ch.Read()
+		d = time.Since(start)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return d, nil
+}
+
+// HealthCheck opens the configured minimum number of idle connections and
+// pings each idle connection, returning the joined errors for any that fail.
+// Failed connections are removed from the pool. If no connections are idle
+// then a single connection is pinged.
+func (c *client) HealthCheck(ctx context.Context) (err error) {
+	ctx, op := c.start(ctx, "HEALTHCHECK", "", "")
+	defer func() { op.end(err) }()
+
+	if err := c.pool.WarmUpContext(ctx); err != nil {
+		return err
+	}
+
+	check := func(ch pool.Channel) error {
+		_, err := withContext(ctx, ch, func() (interface{}, error) {
+			return nil, ping(ch)
+		})
+		if err != nil {
+			return pool.Discard(contextErr(ctx, err))
+		}
+
+		return nil
+	}
+
+	n, err := c.pool.ExecIdle(check)
+	if n > 0 || err != nil {
 		return err
+	}
+
+	return c.pool.ExecContext(ctx, check)
+}
+
+// Help returns the entries of the specified help manual, or the available
+// manuals if manual is empty
+func (c *client) Help(manual string) (entries []string, err error) {
+	_, op := c.start(context.Background(), "HELP", "", "")
+	defer func() { op.end(err, attrResults.Int(len(entries))) }()
+
+	if err := validateIdentifiers(manual); err != nil {
+		return nil, err
+	}
+
+	res, err := c.pool.Query(func(ch pool.Channel) (interface{}, error) {
+		cmd := newCommand(len(manual)+1, "HELP")
+		if manual != "" {
+			cmd.arg(manual)
+		}
+
+		err := ch.Write(cmd.String())
+		if err != nil {
+			return nil, err
+		}
+
+		// RESULT commands(PUSH, POP, COUNT)
+		return ch.Read()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHelp(res.(string))
+}
+
+// Do writes the raw command and returns the raw response, allowing commands
+// that are not otherwise supported to be issued. If the server defers the
+// response then the corresponding EVENT response is returned.
+func (c *client) Do(cmd string) (resp string, err error) {
+	// the span is named after the raw command, such as QUERY
+	name := cmd
+	if f := strings.Fields(cmd); len(f) > 0 {
+		name = strings.ToUpper(f[0])
+	}
+
+	_, op := c.start(context.Background(), name, "", "")
+	defer func() { op.end(err) }()
+
+	if cmd == "" || strings.ContainsAny(cmd, "\r\n") {
+		return "", ErrInvalidCommand
+	}
+
+	res, err := c.pool.Query(func(ch pool.Channel) (interface{}, error) {
+		err := ch.Write(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ch.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		if marker, ok := parsePending(res); ok {
+			return awaitEvent(ch, "", marker)
+		}
+
+		return res, nil
 	})
+	if err != nil {
+		return "", err
+	}
+
+	return res.(string), nil
+}
+
+// WarmUp opens the configured minimum number of idle connections
+func (c *client) WarmUp() error {
+	return c.pool.WarmUp()
+}
+
+// WarmUpN attempts to open n connections, without exceeding the pool size,
+// returning the number opened and any errors
+func (c *client) WarmUpN(ctx context.Context, n int) (int, error) {
+	return c.pool.WarmUpN(ctx, n)
+}
+
+// ServerVersion returns the Sonic server version reported when the connection
+// was established, or an empty string if it is unavailable
+func (c *client) ServerVersion() string {
+	var v string
+	c.inspect(func(ch *channel) {
+		v = ch.version
+	})
+
+	return v
+}
+
+// ProtocolVersion returns the Sonic protocol version negotiated when the
+// connection was established, or zero if it is unavailable
+func (c *client) ProtocolVersion() int {
+	var v int
+	c.inspect(func(ch *channel) {
+		v = ch.protocol
+	})
+
+	return v
+}
+
+// BufferSize returns the server buffer size in bytes negotiated when the
+// connection was established, or zero if it is unavailable
+func (c *client) BufferSize() int {
+	var b int
+	c.inspect(func(ch *channel) {
+		b = ch.bufferSize
+	})
+
+	return b
+}
+
+// MaxTextRunes returns an estimate of the number of text runes sent in a
+// single command, assuming DefaultBytesPerRune bytes per rune, or zero if it is
+// unavailable. Text is split by its escaped length in bytes, so a command can
+// hold more runes of ASCII text and fewer runes of text that requires escaping.
+func (c *client) MaxTextRunes() int {
+	var n int
+	c.inspect(func(ch *channel) {
+		n = ch.maxRunes
+	})
+
+	return n
+}
+
+// PoolStats returns the current connection pool statistics
+func (c *client) PoolStats() pool.Stats {
+	return c.pool.Stats()
+}
+
+// ResizePool sets the connection pool size. Idle connections are closed if the
+// pool is shrunk, with in-use connections closed as they are released.
+func (c *client) ResizePool(n int) {
+	c.pool.Resize(n)
 }
 
 func (c *client) Close() error {
 	return c.pool.Close()
 }
+
+// CloseContext closes all connections, ending each session before the context
+// is done. Connections are closed even if the session could not be ended.
+func (c *client) CloseContext(ctx context.Context) error {
+	return c.pool.CloseContext(ctx)
+}
+
+// Shutdown stops new commands and waits for in-flight commands to complete, or
+// the context to be done, before closing all connections
+func (c *client) Shutdown(ctx context.Context) error {
+	return c.pool.Drain(ctx)
+}
+
+// inspect calls fn with the next available channel, opening one if necessary
+func (c *client) inspect(fn func(*channel)) {
+	c.pool.Exec(func(ch pool.Channel) error {
+		if sc, ok := ch.(*channel); ok {
+			fn(sc)
+		}
+		return nil
+	})
+}
+
+// validateIdentifiers returns ErrInvalidIdentifier if any of the identifiers
+// would be parsed as more than a single command argument
+func validateIdentifiers(ids ...string) error {
+	for _, id := range ids {
+		for _, r := range id {
+			if unicode.IsSpace(r) || unicode.IsControl(r) || r == '"' {
+				return ErrInvalidIdentifier
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRequired returns ErrInvalidIdentifier if any of the identifiers are
+// empty or would be parsed as more than a single command argument
+func validateRequired(ids ...string) error {
+	for _, id := range ids {
+		if id == "" {
+			return ErrInvalidIdentifier
+		}
+	}
+
+	return validateIdentifiers(ids...)
+}
+
+// isRecoverable returns true if the error was returned by the server, meaning
+// that the connection remains usable
+func isRecoverable(err error) bool {
+	var se *SonicError
+	return errors.As(err, &se)
+}
+
+// readOK reads the next response, returning ErrInvalidResponse if it is not OK
+func readOK(ch pool.Channel) error {
+	// OK
+	res, err := ch.Read()
+	if err != nil {
+		return err
+	}
+
+	if res != "OK" {
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
+
+// validate pings the channel, failing if the server does not respond within
+// the timeout or before the context is done
+func validate(ctx context.Context, ch pool.Channel, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	_, err := withContext(ctx, ch, func() (interface{}, error) {
+		return nil, ping(ch)
+	})
+	if err != nil {
+		// the channel is removed, so avoid waiting for the server on close
+		ch.SetDeadline(time.Unix(1, 0))
+	}
+
+	return err
+}
+
+func ping(ch pool.Channel) error {
+	err := ch.Write("PING")
+	if err != nil {
+		return err
+	}
+
+	// PONG
+	res, err := ch.Read()
+	if err != nil {
+		return err
+	}
+
+	if res != "PONG" {
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
+
+func parseHelp(res string) ([]string, error) {
+	m := helpRegexp.FindStringSubmatch(res)
+	if len(m) != 2 {
+		return nil, ErrInvalidResponse
+	}
+
+	var items []string
+	for _, i := range strings.Split(m[1], ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			items = append(items, i)
+		}
+	}
+
+	return items, nil
+}
+
+// withContext executes fn, applying the context deadline and cancellation to
+// the channel for the duration of the call
+func withContext(ctx context.Context, c pool.Channel, fn func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	if d, ok := ctx.Deadline(); ok {
+		if err := c.SetDeadline(d); err != nil {
+			return nil, err
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			// force any blocked read or write to return immediately
+			c.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	res, err := fn()
+	close(stop)
+	<-done
+
+	// the channel is discarded if the context is done or the connection
+	// failed, so leave the deadline in place to avoid blocking on close
+	if ctx.Err() != nil || pool.IsConnErr(err) {
+		return res, err
+	}
+
+	c.SetDeadline(time.Time{})
+	return res, err
+}
+
+// contextErr returns the context error in place of err if the context is done
+func contextErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if cerr := ctx.Err(); cerr != nil {
+		return cerr
+	}
+
+	// the connection deadline can elapse fractionally before the context timer
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
@@ -0,0 +1,1107 @@
+package sonic_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/pool"
+	"github.com/stevecallear/sonic/sonictest"
+)
+
+func TestClient_ServerVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		banner  string
+		connErr error
+		exp     string
+	}{
+		{
+			name:    "should return an empty string on connect errors",
+			connErr: ErrConnect,
+			exp:     "",
+		},
+		{
+			name:   "should return an empty string if the version cannot be parsed",
+			banner: "CONNECTED <sonic-server>",
+			exp:    "",
+		},
+		{
+			name:   "should return the server version",
+			banner: "CONNECTED <sonic-server v1.4.9>",
+			exp:    "1.4.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if tt.connErr == nil {
+				s.On(`^START control \w+$`).
+					Send(tt.banner).
+					Send("STARTED control protocol(1) buffer(20000)")
+			}
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				c := sonic.NewControl(sonic.Options{
+					Password: "password",
+				})
+				defer c.Close()
+
+				AssertDeepEqual(t, c.ServerVersion(), tt.exp)
+			})
+		})
+	}
+}
+
+func TestClient_ProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		banner  string
+		connErr error
+		exp     int
+	}{
+		{
+			name:    "should return zero on connect errors",
+			connErr: ErrConnect,
+		},
+		{
+			name:   "should return zero if the protocol cannot be parsed",
+			banner: "STARTED control buffer(20000)",
+		},
+		{
+			name:   "should return the protocol version",
+			banner: "STARTED control protocol(1) buffer(20000)",
+			exp:    1,
+		},
+		{
+			name:   "should return later protocol versions",
+			banner: "STARTED control protocol(12) buffer(20000)",
+			exp:    12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			if tt.connErr == nil {
+				s.On(`^START control \w+$`).
+					Send("CONNECTED <sonic-server v1.4.9>").
+					Send(tt.banner)
+			}
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				c := sonic.NewControl(sonic.Options{
+					Password: "password",
+				})
+				defer c.Close()
+
+				AssertEqual(t, c.ProtocolVersion(), tt.exp)
+			})
+		})
+	}
+}
+
+func TestClient_BufferSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*Server)
+		connErr  error
+		expBytes int
+		expRunes int
+	}{
+		{
+			name:    "should return zero on connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+		},
+		{
+			name: "should return the negotiated buffer size",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+			},
+			expBytes: 20000,
+			expRunes: 2500, // 20000 / 2 / 4
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			tt.setup(s)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				i := sonic.NewIngest(sonic.Options{
+					Password: "password",
+				})
+				defer i.Close()
+
+				AssertEqual(t, i.BufferSize(), tt.expBytes)
+				AssertEqual(t, i.MaxTextRunes(), tt.expRunes)
+			})
+		})
+	}
+}
+
+func TestClient_MaxTextRunes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options sonic.Options
+		buffer  int
+		exp     int
+	}{
+		{
+			name:   "should use the defaults",
+			buffer: 20000,
+			exp:    2500, // 20000 * 0.5 / 4
+		},
+		{
+			name:    "should use the buffer safety factor",
+			options: sonic.Options{BufferSafetyFactor: 0.75},
+			buffer:  20000,
+			exp:     3750, // 20000 * 0.75 / 4
+		},
+		{
+			name:    "should default invalid safety factors",
+			options: sonic.Options{BufferSafetyFactor: 1.5},
+			buffer:  20000,
+			exp:     2500,
+		},
+		{
+			name:   "should allow at least one rune",
+			buffer: 4,
+			exp:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			s.ConfigureStart("ingest", tt.buffer)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				o := tt.options
+				o.Password = "password"
+
+				i := sonic.NewIngest(o)
+				defer i.Close()
+
+				AssertEqual(t, i.MaxTextRunes(), tt.exp)
+			})
+		})
+	}
+}
+
+func TestClient_Help(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctype   string
+		setup   func(*Server)
+		connErr error
+		manual  string
+		exp     []string
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			ctype:   "search",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			err:     ErrConnect,
+		},
+		{
+			name:   "should return an error if the manual is invalid",
+			ctype:  "search",
+			setup:  func(*Server) {},
+			manual: "my manual",
+			err:    sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return help errors",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^HELP").Send("ERR HELP")
+			},
+			err: errors.New("HELP"),
+		},
+		{
+			name:  "should return an error if the response is invalid",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^HELP$").Send("OK")
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name:  "should return the manuals",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^HELP$").Send("RESULT manuals(commands)")
+			},
+			exp: []string{"commands"},
+		},
+		{
+			name:  "should return ingest manual entries",
+			ctype: "ingest",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^HELP commands$").Send("RESULT commands(PUSH, POP, COUNT, FLUSHC, FLUSHB, FLUSHO, PING, HELP, QUIT)")
+			},
+			manual: "commands",
+			exp:    []string{"PUSH", "POP", "COUNT", "FLUSHC", "FLUSHB", "FLUSHO", "PING", "HELP", "QUIT"},
+		},
+		{
+			name:  "should return control manual entries",
+			ctype: "control",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^HELP commands$").Send("RESULT commands(TRIGGER, INFO, PING, HELP, QUIT)")
+			},
+			manual: "commands",
+			exp:    []string{"TRIGGER", "INFO", "PING", "HELP", "QUIT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				o := sonic.Options{
+					Password: "password",
+				}
+
+				var act []string
+				var err error
+				switch tt.ctype {
+				case "ingest":
+					c := sonic.NewIngest(o)
+					defer c.Close()
+					act, err = c.Help(tt.manual)
+				case "search":
+					c := sonic.NewSearch(o)
+					defer c.Close()
+					act, err = c.Help(tt.manual)
+				case "control":
+					c := sonic.NewControl(o)
+					defer c.Close()
+					act, err = c.Help(tt.manual)
+				}
+
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestClient_Do(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		cmd     string
+		exp     string
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			cmd:     "PING",
+			err:     ErrConnect,
+		},
+		{
+			name:  "should return an error if the command is empty",
+			setup: func(*Server) {},
+			err:   sonic.ErrInvalidCommand,
+		},
+		{
+			name:  "should return an error if the command contains line breaks",
+			setup: func(*Server) {},
+			cmd:   "PING\r\nQUIT",
+			err:   sonic.ErrInvalidCommand,
+		},
+		{
+			name: "should return command errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^CUSTOM$").Send("ERR unknown_command")
+			},
+			cmd: "CUSTOM",
+			err: sonic.ErrUnknownCommand,
+		},
+		{
+			name: "should return the response",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^CUSTOM arg$").Send("RESULT custom")
+			},
+			cmd: "CUSTOM arg",
+			exp: "RESULT custom",
+		},
+		{
+			name: "should return deferred responses",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^LIST collection bucket$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT LIST z98uDE0f word world")
+			},
+			cmd: "LIST collection bucket",
+			exp: "EVENT LIST z98uDE0f word world",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				act, err := search.Do(tt.cmd)
+				AssertError(t, err, tt.err)
+				AssertEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	servers := []*Server{NewServer(), NewServer(), NewServer()}
+	for i, ctype := range []string{"ingest", "search", "control"} {
+		servers[i].ConfigureStart(ctype, 20000)
+		servers[i].On("^PING$").Send("PONG")
+	}
+
+	servers[0].Run(t, func(t *testing.T, ingestConn net.Conn) {
+		servers[1].Run(t, func(t *testing.T, searchConn net.Conn) {
+			servers[2].Run(t, func(t *testing.T, controlConn net.Conn) {
+				conns := []net.Conn{ingestConn, searchConn, controlConn}
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					conn := conns[0]
+					conns = conns[1:]
+					return conn, nil
+				})
+				defer restore()
+
+				c := sonic.NewClient(sonic.Options{
+					Password: "password",
+				})
+
+				if c.Ingest() != c.Ingest() {
+					t.Error("got a new ingest client, expected the existing client")
+				}
+
+				AssertError(t, c.Ingest().Ping(), nil)
+				AssertError(t, c.Search().Ping(), nil)
+				AssertError(t, c.Control().Ping(), nil)
+				AssertError(t, c.Close(), nil)
+				AssertError(t, c.Close(), nil)
+			})
+		})
+	})
+}
+
+func TestClient_Addrs(t *testing.T) {
+	t.Run("should skip addresses that refuse connections", func(t *testing.T) {
+		server := NewServer()
+		server.ConfigureStart("search", 20000)
+		server.On("^PING$").Send("PONG")
+
+		server.Run(t, func(t *testing.T, conn net.Conn) {
+			var dialled []string
+			search := sonic.NewSearch(sonic.Options{
+				Addrs:    []string{"dead:1491", "healthy:1491"},
+				Password: "password",
+				Dialer: func(_ context.Context, addr string) (net.Conn, error) {
+					dialled = append(dialled, addr)
+					if addr == "dead:1491" {
+						return nil, ErrConnect
+					}
+					return conn, nil
+				},
+			})
+			defer search.Close()
+
+			AssertError(t, search.Ping(), nil)
+			AssertDeepEqual(t, dialled, []string{"dead:1491", "healthy:1491"})
+		})
+	})
+
+	t.Run("should distribute channels across addresses", func(t *testing.T) {
+		servers := []*Server{NewServer(), NewServer()}
+		for _, s := range servers {
+			s.ConfigureStart("search", 20000)
+		}
+
+		servers[0].Run(t, func(t *testing.T, conn1 net.Conn) {
+			servers[1].Run(t, func(t *testing.T, conn2 net.Conn) {
+				conns := map[string]net.Conn{"node1:1491": conn1, "node2:1491": conn2}
+
+				search := sonic.NewSearch(sonic.Options{
+					Addrs:       []string{"node1:1491", "node2:1491"},
+					Password:    "password",
+					PoolSize:    2,
+					PoolMinIdle: 2,
+					Dialer: func(_ context.Context, addr string) (net.Conn, error) {
+						return conns[addr], nil
+					},
+				})
+				defer search.Close()
+
+				AssertError(t, search.WarmUp(), nil)
+			})
+		})
+	})
+}
+
+func TestClient_PoolTimeout(t *testing.T) {
+	t.Run("should not include the connect time", func(t *testing.T) {
+		s := NewServer()
+		s.ConfigureStart("control", 20000)
+		s.On("^PING$").Send("PONG")
+
+		s.Run(t, func(t *testing.T, conn net.Conn) {
+			c := sonic.NewControl(sonic.Options{
+				Password:       "password",
+				PoolTimeout:    10 * time.Millisecond,
+				ConnectTimeout: time.Second,
+				Dialer: func(context.Context, string) (net.Conn, error) {
+					time.Sleep(50 * time.Millisecond)
+					return conn, nil
+				},
+			})
+			defer c.Close()
+
+			AssertError(t, c.Ping(), nil)
+		})
+	})
+
+	t.Run("should not wait for other connections", func(t *testing.T) {
+		s := NewServer()
+		s.ConfigureStart("control", 20000)
+		s.On("^PING$").Send("PONG")
+
+		s.Run(t, func(t *testing.T, conn net.Conn) {
+			dialled := make(chan struct{})
+			c := sonic.NewControl(sonic.Options{
+				Password:       "password",
+				PoolTimeout:    10 * time.Millisecond,
+				ConnectTimeout: time.Second,
+				Dialer: func(context.Context, string) (net.Conn, error) {
+					close(dialled)
+					time.Sleep(100 * time.Millisecond)
+					return conn, nil
+				},
+			})
+			defer c.Close()
+
+			done := make(chan error)
+			go func() {
+				done <- c.Ping()
+			}()
+			<-dialled
+
+			start := time.Now()
+			AssertError(t, c.Ping(), pool.ErrTimeout)
+
+			if d := time.Since(start); d > 50*time.Millisecond {
+				t.Errorf("got %v, expected the pool timeout", d)
+			}
+
+			AssertError(t, <-done, nil)
+		})
+	})
+}
+
+func TestClient_WarmUp(t *testing.T) {
+	l := ServeLoopback(t, 20000)
+	defer l.Close()
+
+	var dials int
+	c := sonic.NewClient(sonic.Options{
+		Addr:     l.Addr().String(),
+		Password: "password",
+		PoolSize: 3,
+		Dialer: func(ctx context.Context, addr string) (net.Conn, error) {
+			if dials++; dials == 3 {
+				return nil, ErrConnect
+			}
+			return sonic.DialTCPContext(ctx, addr)
+		},
+	})
+	defer c.Close()
+
+	n, err := c.WarmUp(context.Background(), 3)
+	AssertEqual(t, n, 0)
+	AssertError(t, err, nil)
+
+	c.Search()
+
+	n, err = c.WarmUp(context.Background(), 3)
+	AssertEqual(t, n, 2)
+	AssertError(t, err, ErrConnect)
+	AssertDeepEqual(t, c.Search().PoolStats(), pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2})
+}
+
+func TestClient_PingLatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		min     time.Duration
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			err:     ErrConnect,
+		},
+		{
+			name: "should return ping errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PING$").Send("ERR PING")
+			},
+			err: errors.New("PING"),
+		},
+		{
+			name: "should return the round trip time",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PING$").Delay(20 * time.Millisecond).Send("PONG")
+			},
+			min: 20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+				})
+				defer ingest.Close()
+
+				// establish the connection so that only the ping is measured
+				ingest.WarmUp()
+
+				act, err := ingest.PingLatency()
+				AssertError(t, err, tt.err)
+
+				if act < tt.min || (tt.err != nil && act != 0) {
+					t.Errorf("got %v, expected at least %v", act, tt.min)
+				}
+			})
+		})
+	}
+}
+
+func TestClient_HealthCheck(t *testing.T) {
+	t.Run("should ping a single connection if none are idle", func(t *testing.T) {
+		server := NewServer()
+		server.ConfigureStart("search", 20000)
+		server.On("^PING$").Send("PONG")
+
+		server.Run(t, func(t *testing.T, conn net.Conn) {
+			restore := SetDialTCP(func(string) (net.Conn, error) {
+				return conn, nil
+			})
+			defer restore()
+
+			search := sonic.NewSearch(sonic.Options{
+				Password: "password",
+			})
+			defer search.Close()
+
+			AssertError(t, search.HealthCheck(context.Background()), nil)
+		})
+	})
+
+	t.Run("should bound the warm up by the context", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+		go io.Copy(io.Discard, server) // never send the banner
+
+		search := sonic.NewSearch(sonic.Options{
+			Password:    "password",
+			PoolMinIdle: 1,
+			Dialer: func(context.Context, string) (net.Conn, error) {
+				return client, nil
+			},
+		})
+		defer search.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() { done <- search.HealthCheck(ctx) }()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("got nil, expected an error")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("health check was not bounded by the context")
+		}
+	})
+
+	t.Run("should remove connections that fail", func(t *testing.T) {
+		servers := []*Server{NewServer(), NewServer()}
+		servers[0].ConfigureStart("search", 20000)
+		servers[0].On("^PING$").Send("PONG")
+		servers[1].ConfigureStart("search", 20000)
+		servers[1].On("^PING$").Send("ERR PING")
+
+		servers[0].Run(t, func(t *testing.T, conn1 net.Conn) {
+			servers[1].Run(t, func(t *testing.T, conn2 net.Conn) {
+				conns := map[string]net.Conn{"node1:1491": conn1, "node2:1491": conn2}
+
+				search := sonic.NewSearch(sonic.Options{
+					Addrs:       []string{"node1:1491", "node2:1491"},
+					Password:    "password",
+					PoolSize:    2,
+					PoolMinIdle: 2,
+					Dialer: func(_ context.Context, addr string) (net.Conn, error) {
+						return conns[addr], nil
+					},
+				})
+				defer search.Close()
+
+				err := search.HealthCheck(context.Background())
+				if err == nil || !strings.Contains(err.Error(), "PING") {
+					t.Errorf("got %v, expected a ping error", err)
+				}
+
+				AssertDeepEqual(t, search.PoolStats(), pool.Stats{MaxSize: 2, CurSize: 1, Idle: 1})
+			})
+		})
+	})
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	s := NewServer()
+	s.ConfigureStart("search", 20000)
+	s.On(`^QUERY collection bucket "terms"$`).
+		Delay(50 * time.Millisecond).
+		Send("PENDING abc").
+		Send("EVENT QUERY abc o1")
+
+	s.Run(t, func(t *testing.T, conn net.Conn) {
+		c := sonic.NewClient(sonic.Options{
+			Password: "password",
+			Dialer:   sonictest.Dialer(conn),
+		})
+
+		done := make(chan error)
+		go func() {
+			_, err := c.Search().Query(sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "terms",
+			})
+			done <- err
+		}()
+
+		// wait for the query to be in flight
+		for c.Search().PoolStats().InUse == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		AssertError(t, c.Shutdown(ctx), nil)
+		AssertDeepEqual(t, c.Search().PoolStats(), pool.Stats{MaxSize: 1})
+
+		// the connection is only closed once the query has completed
+		AssertError(t, <-done, nil)
+		AssertError(t, c.Search().Ping(), pool.ErrClosed)
+	})
+}
+
+func TestWithOperationTimeout(t *testing.T) {
+	t.Run("should apply the timeout to the connection", func(t *testing.T) {
+		s := NewServer()
+		s.ConfigureStart("search", 20000)
+		s.On(`^QUERY`).Send("PENDING abc")
+
+		s.Run(t, func(t *testing.T, conn net.Conn) {
+			search := sonic.NewSearch(sonic.Options{
+				Password: "password",
+				Dialer:   sonictest.Dialer(conn),
+			})
+			defer search.Close()
+
+			ctx, cancel := sonic.WithOperationTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := search.QueryContext(ctx, sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "terms",
+			})
+			AssertError(t, err, context.DeadlineExceeded)
+		})
+	})
+
+	t.Run("should apply the timeout to each operation", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			ctype   string
+			pattern string
+			fn      func(context.Context, *sonic.Client) error
+		}{
+			{
+				name:    "push",
+				ctype:   "ingest",
+				pattern: `^PUSH`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					err := c.Ingest().PushContext(ctx, sonic.PushRequest{
+						Collection: "collection",
+						Bucket:     "bucket",
+						Object:     "object",
+						Text:       "text",
+					})
+
+					var pe *sonic.PushError
+					if !errors.As(err, &pe) {
+						t.Errorf("got %T, expected *sonic.PushError", err)
+					}
+					return err
+				},
+			},
+			{
+				name:    "pop",
+				ctype:   "ingest",
+				pattern: `^POP`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					_, err := c.Ingest().PopContext(ctx, sonic.PopRequest{
+						Collection: "collection",
+						Bucket:     "bucket",
+						Object:     "object",
+						Text:       "text",
+					})
+					return err
+				},
+			},
+			{
+				name:    "count",
+				ctype:   "ingest",
+				pattern: `^COUNT`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					_, err := c.Ingest().CountContext(ctx, sonic.CountRequest{Collection: "collection"})
+					return err
+				},
+			},
+			{
+				name:    "flush",
+				ctype:   "ingest",
+				pattern: `^FLUSHC`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					_, err := c.Ingest().FlushContext(ctx, sonic.FlushRequest{Collection: "collection"})
+					return err
+				},
+			},
+			{
+				name:    "trigger",
+				ctype:   "control",
+				pattern: `^TRIGGER`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					return c.Control().TriggerContext(ctx, sonic.TriggerRequest{Action: sonic.ActionConsolidate})
+				},
+			},
+			{
+				name:    "info",
+				ctype:   "control",
+				pattern: `^INFO`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					_, err := c.Control().InfoContext(ctx)
+					return err
+				},
+			},
+			{
+				name:    "ping",
+				ctype:   "search",
+				pattern: `^PING`,
+				fn: func(ctx context.Context, c *sonic.Client) error {
+					return c.Search().PingContext(ctx)
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s := NewServer()
+				s.ConfigureStart(tt.ctype, 20000)
+				s.On(tt.pattern).Delay(200 * time.Millisecond).Send("ERR late")
+
+				s.Run(t, func(t *testing.T, conn net.Conn) {
+					c := sonic.NewClient(sonic.Options{
+						Password: "password",
+						Dialer:   sonictest.Dialer(conn),
+					})
+					defer c.Close()
+
+					ctx, cancel := sonic.WithOperationTimeout(context.Background(), 50*time.Millisecond)
+					defer cancel()
+
+					AssertError(t, tt.fn(ctx, c), context.DeadlineExceeded)
+				})
+			})
+		}
+	})
+
+	t.Run("should override the pool timeout", func(t *testing.T) {
+		s := NewServer()
+		s.ConfigureStart("search", 20000)
+		s.On(`^QUERY collection bucket "slow"$`).
+			Delay(100 * time.Millisecond).
+			Send("PENDING abc").
+			Send("EVENT QUERY abc o1")
+		s.On(`^QUERY collection bucket "fast"$`).
+			Send("PENDING def").
+			Send("EVENT QUERY def o2")
+
+		s.Run(t, func(t *testing.T, conn net.Conn) {
+			search := sonic.NewSearch(sonic.Options{
+				Password:    "password",
+				PoolTimeout: 10 * time.Millisecond,
+				Dialer:      sonictest.Dialer(conn),
+			})
+			defer search.Close()
+
+			done := make(chan error)
+			go func() {
+				_, err := search.Query(sonic.QueryRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Terms:      "slow",
+				})
+				done <- err
+			}()
+
+			// wait for the query to be in flight
+			for search.PoolStats().InUse == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, cancel := sonic.WithOperationTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			act, err := search.QueryContext(ctx, sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "fast",
+			})
+			AssertError(t, err, nil)
+			AssertDeepEqual(t, act, []string{"o2"})
+			AssertError(t, <-done, nil)
+		})
+	})
+}
+
+func TestClient_CloseContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	// complete the handshake and respond to pings, but never respond to QUIT
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		r := bufio.NewReader(server)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				return // the client closed the connection
+			}
+
+			switch {
+			case strings.HasPrefix(s, "START"):
+				server.Write([]byte("CONNECTED <sonic-server v1.2.3>\r\n"))
+				server.Write([]byte("STARTED search protocol(1) buffer(20000)\r\n"))
+			case strings.HasPrefix(s, "PING"):
+				server.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+
+	c := sonic.NewClient(sonic.Options{
+		Password: "password",
+		Dialer:   sonictest.Dialer(client),
+	})
+
+	AssertError(t, c.Search().Ping(), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assertTimeout(t, c.CloseContext(ctx))
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("got %v, expected the close to be bounded by the context", d)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestWithContext_Silent(t *testing.T) {
+	c := sonic.NewSearch(sonic.Options{
+		Password: "password",
+		Dialer:   sonictest.Dialer(SilentConn("search")),
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the discarded channel is closed without waiting for the server
+	done := make(chan error)
+	go func() {
+		_, err := c.QueryContext(ctx, sonic.QueryRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Terms:      "terms",
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		AssertError(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("expected the query to be bounded by the context")
+	}
+
+	AssertDeepEqual(t, c.PoolStats(), pool.Stats{MaxSize: 1})
+}
+
+func TestClient_PoolMaxIdleTime(t *testing.T) {
+	// complete the handshake, but never respond to pings
+	client := SilentConn("search")
+
+	var dialled bool
+	c := sonic.NewSearch(sonic.Options{
+		Password:        "password",
+		PoolMinIdle:     1,
+		PoolMaxIdleTime: time.Nanosecond,
+		Dialer: func(context.Context, string) (net.Conn, error) {
+			if dialled {
+				return nil, ErrConnect
+			}
+
+			dialled = true
+			return client, nil
+		},
+	})
+	defer c.Close()
+
+	AssertError(t, c.WarmUp(), nil)
+	time.Sleep(time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the idle channel ping is bounded by the context
+	start := time.Now()
+	_, err := c.QueryContext(ctx, sonic.QueryRequest{
+		Collection: "collection",
+		Bucket:     "bucket",
+		Terms:      "terms",
+	})
+	if err == nil {
+		t.Error("got nil, expected an error")
+	}
+
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("got %v, expected the ping to be bounded by the context", d)
+	}
+}
+
+func TestClient_KeepAlivePing(t *testing.T) {
+	// complete the handshake, but never respond to pings
+	client := SilentConn("search")
+
+	c := sonic.NewSearch(sonic.Options{
+		Password:              "password",
+		Dialer:                sonictest.Dialer(client),
+		PoolMinIdle:           1,
+		KeepAlivePingInterval: 5 * time.Millisecond,
+		PingTimeout:           20 * time.Millisecond,
+	})
+	defer c.Close()
+
+	AssertError(t, c.WarmUp(), nil)
+
+	// the ping times out, so the channel is removed
+	exp := pool.Stats{MaxSize: 1}
+	for end := time.Now().Add(time.Second); c.PoolStats() != exp; {
+		if time.Now().After(end) {
+			t.Fatalf("got %+v, expected %+v", c.PoolStats(), exp)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
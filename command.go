@@ -0,0 +1,94 @@
+package sonic
+
+import (
+	"strconv"
+	"strings"
+)
+
+// escaper escapes text for use within a quoted command argument
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`, `"`, `\"`)
+
+// Escape escapes backslashes, line feeds, carriage returns, tabs and double
+// quotes so that the text can be used within a quoted command argument, for
+// example with Do
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// Quote escapes the text and wraps it in double quotes
+func Quote(s string) string {
+	return `"` + Escape(s) + `"`
+}
+
+// command builds a command line in a single buffer, avoiding the intermediate
+// allocations of formatting each part separately
+type command struct {
+	b strings.Builder
+}
+
+// newCommand returns a command with the verb and arguments, with capacity for
+// the specified number of additional bytes
+func newCommand(n int, verb string, args ...string) *command {
+	for _, a := range args {
+		n += len(a) + 1
+	}
+
+	c := new(command)
+	c.b.Grow(len(verb) + n)
+	c.b.WriteString(verb)
+
+	for _, a := range args {
+		c.arg(a)
+	}
+
+	return c
+}
+
+// arg appends an argument
+func (c *command) arg(s string) *command {
+	c.b.WriteByte(' ')
+	c.b.WriteString(s)
+	return c
+}
+
+// text appends a quoted text argument
+func (c *command) text(s string) *command {
+	c.b.WriteString(` "`)
+	c.b.WriteString(s)
+	c.b.WriteByte('"')
+	return c
+}
+
+// param appends a NAME(value) parameter if the value is not empty
+func (c *command) param(name, value string) *command {
+	if value == "" {
+		return c
+	}
+
+	c.b.WriteByte(' ')
+	c.b.WriteString(name)
+	c.b.WriteByte('(')
+	c.b.WriteString(value)
+	c.b.WriteByte(')')
+	return c
+}
+
+// intParam appends a NAME(value) parameter if the value is positive
+func (c *command) intParam(name string, value int) *command {
+	if value <= 0 {
+		return c
+	}
+
+	var buf [20]byte
+	c.b.WriteByte(' ')
+	c.b.WriteString(name)
+	c.b.WriteByte('(')
+	c.b.Write(strconv.AppendInt(buf[:0], int64(value), 10))
+	c.b.WriteByte(')')
+	return c
+}
+
+// String returns the command line
+func (c *command) String() string {
+	return c.b.String()
+}
@@ -0,0 +1,92 @@
+package sonic_test
+
+import (
+	"testing"
+
+	"github.com/stevecallear/sonic"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		exp   string
+	}{
+		{
+			name:  "should not modify plain text",
+			input: "the quick brown fox",
+			exp:   "the quick brown fox",
+		},
+		{
+			name:  "should escape backslashes",
+			input: `a\b`,
+			exp:   `a\\b`,
+		},
+		{
+			name:  "should escape line feeds",
+			input: "a\nb",
+			exp:   `a\nb`,
+		},
+		{
+			name:  "should escape carriage returns",
+			input: "a\r\nb",
+			exp:   `a\r\nb`,
+		},
+		{
+			name:  "should escape tabs",
+			input: "a\tb",
+			exp:   `a\tb`,
+		},
+		{
+			name:  "should not double escape escaped sequences",
+			input: `a\tb\r`,
+			exp:   `a\\tb\\r`,
+		},
+		{
+			name:  "should escape double quotes",
+			input: `a "b"`,
+			exp:   `a \"b\"`,
+		},
+		{
+			name:  "should escape mixed text",
+			input: "\\ \n \" \\",
+			exp:   `\\ \n \" \\`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertDeepEqual(t, sonic.Escape(tt.input), tt.exp)
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		exp   string
+	}{
+		{
+			name:  "should quote empty text",
+			input: "",
+			exp:   `""`,
+		},
+		{
+			name:  "should quote plain text",
+			input: "text",
+			exp:   `"text"`,
+		},
+		{
+			name:  "should escape and quote text",
+			input: "say \"hi\"\n",
+			exp:   `"say \"hi\"\n"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertDeepEqual(t, sonic.Quote(tt.input), tt.exp)
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package sonic
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/stevecallear/sonic/pool"
@@ -19,6 +21,7 @@ type (
 	TriggerRequest struct {
 		Action string
 		Data   string // optional
+		Raw    bool   // optional, sends the action without validation
 	}
 
 	// InfoResponse represents an info response
@@ -31,10 +34,42 @@ type (
 		KVOpenCount         int
 		FSTOpenCount        int
 		FSTConsolidateCount int
+		Extra               map[string]string // fields not mapped above
 	}
 )
 
-var infoRegexp = regexp.MustCompile(`^RESULT uptime\((\d+)\) clients_connected\((\d+)\) commands_total\((\d+)\) command_latency_best\((\d+)\) command_latency_worst\((\d+)\) kv_open_count\((\d+)\) fst_open_count\((\d+)\) fst_consolidate_count\((\d+)\)$`)
+const (
+	// ActionConsolidate consolidates pending index updates
+	ActionConsolidate = "consolidate"
+
+	// ActionBackup backs up the index to the path specified in the request data
+	ActionBackup = "backup"
+
+	// ActionRestore restores the index from the path specified in the request data
+	ActionRestore = "restore"
+)
+
+var (
+	// ErrUnknownAction indicates that a trigger action is not supported
+	ErrUnknownAction = errors.New("unknown action")
+
+	// ErrInvalidPath indicates that a backup or restore path is empty or contains
+	// whitespace, control or quote characters
+	ErrInvalidPath = errors.New("invalid path")
+
+	infoRegexp = regexp.MustCompile(`(\w+)\(([^)]*)\)`)
+
+	infoFields = map[string]func(*InfoResponse, int){
+		"uptime":                func(r *InfoResponse, n int) { r.Uptime = time.Duration(n) * time.Second },
+		"clients_connected":     func(r *InfoResponse, n int) { r.ClientsConnected = n },
+		"commands_total":        func(r *InfoResponse, n int) { r.CommandsTotal = n },
+		"command_latency_best":  func(r *InfoResponse, n int) { r.CommandLatencyBest = time.Duration(n) * time.Millisecond },
+		"command_latency_worst": func(r *InfoResponse, n int) { r.CommandLatencyWorst = time.Duration(n) * time.Millisecond },
+		"kv_open_count":         func(r *InfoResponse, n int) { r.KVOpenCount = n },
+		"fst_open_count":        func(r *InfoResponse, n int) { r.FSTOpenCount = n },
+		"fst_consolidate_count": func(r *InfoResponse, n int) { r.FSTConsolidateCount = n },
+	}
+)
 
 // NewControl returns a new control client
 func NewControl(o Options) *Control {
@@ -43,62 +78,133 @@ func NewControl(o Options) *Control {
 	}
 }
 
-// Trigger triggers an action
+// Trigger triggers an action, returning ErrUnknownAction if the action is not
+// supported unless the request is raw
 func (c *Control) Trigger(r TriggerRequest) error {
-	return c.pool.Exec(func(ch pool.Channel) error {
-		msg := fmt.Sprintf("TRIGGER %s", r.Action)
-		if r.Data != "" {
-			msg = fmt.Sprintf("%s %s", msg, r.Data)
-		}
+	return c.TriggerContext(context.Background(), r)
+}
 
-		err := ch.Write(msg)
-		if err != nil {
+// TriggerContext triggers an action using the specified context, returning
+// ErrUnknownAction if the action is not supported unless the request is raw
+func (c *Control) TriggerContext(ctx context.Context, r TriggerRequest) (err error) {
+	ctx, op := c.start(ctx, "TRIGGER", "", "")
+	op.span.SetAttributes(attrAction.String(r.Action))
+	defer func() { op.end(err) }()
+
+	if !r.Raw {
+		if err := validateTrigger(r); err != nil {
 			return err
 		}
+	}
+
+	err = c.pool.ExecContext(ctx, func(ch pool.Channel) error {
+		_, err := withContext(ctx, ch, func() (interface{}, error) {
+			cmd := newCommand(len(r.Data)+1, "TRIGGER", r.Action)
+			if r.Data != "" {
+				cmd.arg(r.Data)
+			}
+
+			err := ch.Write(cmd.String())
+			if err != nil {
+				return nil, err
+			}
 
-		// OK
-		_, err = ch.Read()
+			return nil, readOK(ch)
+		})
 		return err
 	})
+
+	return contextErr(ctx, err)
+}
+
+// Consolidate triggers the consolidation of pending index updates
+func (c *Control) Consolidate() error {
+	return c.Trigger(TriggerRequest{Action: ActionConsolidate})
+}
+
+// Backup triggers a backup of the index to the specified server path
+func (c *Control) Backup(path string) error {
+	return c.Trigger(TriggerRequest{Action: ActionBackup, Data: path})
+}
+
+// Restore triggers a restore of the index from the specified server path
+func (c *Control) Restore(path string) error {
+	return c.Trigger(TriggerRequest{Action: ActionRestore, Data: path})
 }
 
 // Info returns server information
 func (c *Control) Info() (InfoResponse, error) {
-	res, err := c.pool.Query(func(ch pool.Channel) (interface{}, error) {
-		err := ch.Write("INFO")
-		if err != nil {
-			return "", err
-		}
+	return c.InfoContext(context.Background())
+}
+
+// InfoContext returns server information using the specified context
+func (c *Control) InfoContext(ctx context.Context) (info InfoResponse, err error) {
+	ctx, op := c.start(ctx, "INFO", "", "")
+	defer func() { op.end(err) }()
 
-		return ch.Read()
+	res, err := c.pool.QueryContext(ctx, func(ch pool.Channel) (interface{}, error) {
+		return withContext(ctx, ch, func() (interface{}, error) {
+			err := ch.Write("INFO")
+			if err != nil {
+				return "", err
+			}
+
+			return ch.Read()
+		})
 	})
 	if err != nil {
-		return InfoResponse{}, err
+		return InfoResponse{}, contextErr(ctx, err)
+	}
+
+	return parseInfo(res.(string))
+}
+
+func validateTrigger(r TriggerRequest) error {
+	switch r.Action {
+	case ActionConsolidate:
+		return nil
+	case ActionBackup, ActionRestore:
+		return validatePath(r.Data)
+	default:
+		return ErrUnknownAction
 	}
+}
 
-	strs := infoRegexp.FindStringSubmatch(res.(string))
-	if len(strs) != 9 {
+// validatePath returns ErrInvalidPath if the path is empty or would be parsed
+// as more than a single command argument
+func validatePath(path string) error {
+	if path == "" || validateIdentifiers(path) != nil {
+		return ErrInvalidPath
+	}
+
+	return nil
+}
+
+// parseInfo parses the key(value) pairs in an INFO response, collecting unknown keys
+func parseInfo(msg string) (InfoResponse, error) {
+	if !strings.HasPrefix(msg, "RESULT ") {
 		return InfoResponse{}, ErrInvalidResponse
 	}
 
-	ints := make([]int, len(strs)-1, len(strs)-1)
-	for idx, s := range strs[1:] {
-		i, err := strconv.Atoi(s)
+	var ir InfoResponse
+	for _, m := range infoRegexp.FindAllStringSubmatch(msg, -1) {
+		set, ok := infoFields[m[1]]
+		if !ok {
+			if ir.Extra == nil {
+				ir.Extra = map[string]string{}
+			}
+
+			ir.Extra[m[1]] = m[2]
+			continue
+		}
+
+		n, err := strconv.Atoi(m[2])
 		if err != nil {
 			return InfoResponse{}, ErrInvalidResponse
 		}
 
-		ints[idx] = i
+		set(&ir, n)
 	}
 
-	return InfoResponse{
-		Uptime:              time.Duration(ints[0]) * time.Second,
-		ClientsConnected:    ints[1],
-		CommandsTotal:       ints[2],
-		CommandLatencyBest:  time.Duration(ints[3]) * time.Millisecond,
-		CommandLatencyWorst: time.Duration(ints[4]) * time.Millisecond,
-		KVOpenCount:         ints[5],
-		FSTOpenCount:        ints[6],
-		FSTConsolidateCount: ints[7],
-	}, nil
+	return ir, nil
 }
@@ -66,7 +66,26 @@ func TestControl_Trigger(t *testing.T) {
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
 			connErr: ErrConnect,
-			err:     ErrConnect,
+			request: sonic.TriggerRequest{
+				Action: sonic.ActionConsolidate,
+			},
+			err: ErrConnect,
+		},
+		{
+			name:  "should return an error if the action is unknown",
+			setup: func(*Server) {},
+			request: sonic.TriggerRequest{
+				Action: "consolidat",
+			},
+			err: sonic.ErrUnknownAction,
+		},
+		{
+			name:  "should return an error if the backup path is empty",
+			setup: func(*Server) {},
+			request: sonic.TriggerRequest{
+				Action: sonic.ActionBackup,
+			},
+			err: sonic.ErrInvalidPath,
 		},
 		{
 			name: "should return trigger errors",
@@ -74,20 +93,45 @@ func TestControl_Trigger(t *testing.T) {
 				s.ConfigureStart("control", 20000)
 				s.On("^TRIGGER").Send("ERR TRIGGER")
 			},
+			request: sonic.TriggerRequest{
+				Action: sonic.ActionConsolidate,
+			},
 			err: errors.New("TRIGGER"),
 		},
+		{
+			name: "should return an error if the response is not ok",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER").Send("RESULT 5")
+			},
+			request: sonic.TriggerRequest{
+				Action: sonic.ActionConsolidate,
+			},
+			err: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should trigger the action",
 			setup: func(s *Server) {
 				s.ConfigureStart("control", 20000)
-				s.On("^TRIGGER action$").Send("OK")
+				s.On("^TRIGGER consolidate$").Send("OK")
 			},
 			request: sonic.TriggerRequest{
-				Action: "action",
+				Action: sonic.ActionConsolidate,
 			},
 		},
 		{
 			name: "should include optional parameters",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER backup data$").Send("OK")
+			},
+			request: sonic.TriggerRequest{
+				Action: sonic.ActionBackup,
+				Data:   "data",
+			},
+		},
+		{
+			name: "should trigger raw actions",
 			setup: func(s *Server) {
 				s.ConfigureStart("control", 20000)
 				s.On("^TRIGGER action data$").Send("OK")
@@ -95,6 +139,7 @@ func TestControl_Trigger(t *testing.T) {
 			request: sonic.TriggerRequest{
 				Action: "action",
 				Data:   "data",
+				Raw:    true,
 			},
 		},
 	}
@@ -122,6 +167,95 @@ func TestControl_Trigger(t *testing.T) {
 	}
 }
 
+func TestControl_Actions(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Server)
+		fn    func(*sonic.Control) error
+		err   error
+	}{
+		{
+			name: "should trigger consolidate",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER consolidate$").Send("OK")
+			},
+			fn: func(c *sonic.Control) error {
+				return c.Consolidate()
+			},
+		},
+		{
+			name: "should trigger backup",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER backup /var/backup/sonic$").Send("OK")
+			},
+			fn: func(c *sonic.Control) error {
+				return c.Backup("/var/backup/sonic")
+			},
+		},
+		{
+			name:  "should return an error if the backup path is empty",
+			setup: func(*Server) {},
+			fn: func(c *sonic.Control) error {
+				return c.Backup("")
+			},
+			err: sonic.ErrInvalidPath,
+		},
+		{
+			name: "should trigger restore",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER restore /var/backup/sonic$").Send("OK")
+			},
+			fn: func(c *sonic.Control) error {
+				return c.Restore("/var/backup/sonic")
+			},
+		},
+		{
+			name:  "should return an error if the restore path is invalid",
+			setup: func(*Server) {},
+			fn: func(c *sonic.Control) error {
+				return c.Restore("/var/my backup")
+			},
+			err: sonic.ErrInvalidPath,
+		},
+		{
+			name: "should return trigger errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^TRIGGER restore").Send("ERR TRIGGER")
+			},
+			fn: func(c *sonic.Control) error {
+				return c.Restore("/var/backup/sonic")
+			},
+			err: errors.New("TRIGGER"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				control := sonic.NewControl(sonic.Options{
+					Password: "password",
+				})
+				defer control.Close()
+
+				err := tt.fn(control)
+				AssertError(t, err, tt.err)
+			})
+		})
+	}
+}
+
 func TestControl_Info(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -177,6 +311,39 @@ func TestControl_Info(t *testing.T) {
 				FSTConsolidateCount: 7,
 			},
 		},
+		{
+			name: "should return unknown fields",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^INFO$").Send("RESULT uptime(18) clients_connected(2) commands_total(1) command_latency_best(3) command_latency_worst(4) kv_open_count(5) fst_open_count(6) fst_consolidate_count(7) some_new_metric(42)")
+			},
+			exp: sonic.InfoResponse{
+				Uptime:              18 * time.Second,
+				ClientsConnected:    2,
+				CommandsTotal:       1,
+				CommandLatencyBest:  3 * time.Millisecond,
+				CommandLatencyWorst: 4 * time.Millisecond,
+				KVOpenCount:         5,
+				FSTOpenCount:        6,
+				FSTConsolidateCount: 7,
+				Extra: map[string]string{
+					"some_new_metric": "42",
+				},
+			},
+		},
+		{
+			name: "should parse fields in any order",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^INFO$").Send("RESULT fst_consolidate_count(7) kv_open_count(5) uptime(18) clients_connected(2)")
+			},
+			exp: sonic.InfoResponse{
+				Uptime:              18 * time.Second,
+				ClientsConnected:    2,
+				KVOpenCount:         5,
+				FSTConsolidateCount: 7,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -197,7 +364,7 @@ func TestControl_Info(t *testing.T) {
 
 				act, err := control.Info()
 				AssertError(t, err, tt.err)
-				AssertEqual(t, act, tt.exp)
+				AssertDeepEqual(t, act, tt.exp)
 			})
 		})
 	}
@@ -224,6 +391,14 @@ func TestControl_Ping(t *testing.T) {
 			},
 			exp: errors.New("PING"),
 		},
+		{
+			name: "should return an error if the response is not pong",
+			setup: func(s *Server) {
+				s.ConfigureStart("control", 20000)
+				s.On("^PING$").Send("STARTED control protocol(1) buffer(20000)")
+			},
+			exp: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should ping the server",
 			setup: func(s *Server) {
@@ -0,0 +1,87 @@
+package sonic
+
+import (
+	"errors"
+	"strings"
+)
+
+type (
+	// SonicError represents an ERR response returned by the server
+	SonicError struct {
+		Code    string
+		Message string
+	}
+
+	// endedError represents an ENDED response, including the reason
+	endedError struct {
+		reason string
+	}
+)
+
+// ErrConnectionEnded indicates that the server ended the session, after which
+// the connection cannot be used
+var ErrConnectionEnded = errors.New("connection ended")
+
+var (
+	// ErrUnauthorized indicates that the server rejected the password
+	ErrUnauthorized = &SonicError{Code: "authentication_failed"}
+
+	// ErrUnknownCommand indicates that the server did not recognise the command
+	ErrUnknownCommand = &SonicError{Code: "unknown_command"}
+
+	// ErrInvalidFormat indicates that the server could not parse the command
+	ErrInvalidFormat = &SonicError{Code: "invalid_format"}
+
+	// ErrBufferOverflow indicates that the command exceeded the server buffer
+	ErrBufferOverflow = &SonicError{Code: "buffer_overflow"}
+
+	// ErrNotFound indicates that the requested item was not found
+	ErrNotFound = &SonicError{Code: "not_found"}
+
+	// ErrQuery indicates that the server failed to execute the query
+	ErrQuery = &SonicError{Code: "query_error"}
+
+	// ErrInternal indicates that an internal server error occurred
+	ErrInternal = &SonicError{Code: "internal_error"}
+
+	// ErrShuttingDown indicates that the server is shutting down
+	ErrShuttingDown = &SonicError{Code: "shutting_down"}
+
+	// ErrPolicyReject indicates that the server rejected the command by policy
+	ErrPolicyReject = &SonicError{Code: "policy_reject"}
+)
+
+// newSonicError returns a new error for the specified ERR response message,
+// using the reason up to any opening bracket as the code
+func newSonicError(msg string) *SonicError {
+	code := msg
+	if i := strings.IndexAny(code, "( "); i >= 0 {
+		code = code[:i]
+	}
+
+	return &SonicError{Code: code, Message: msg}
+}
+
+// Error returns the error message
+func (e *SonicError) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Message
+}
+
+// Is returns true if the target is a SonicError with the same code
+func (e *SonicError) Is(target error) bool {
+	t, ok := target.(*SonicError)
+	return ok && t.Code == e.Code
+}
+
+// Error returns the error message
+func (e *endedError) Error() string {
+	return ErrConnectionEnded.Error() + ": " + e.reason
+}
+
+// Is returns true if the target is ErrConnectionEnded
+func (e *endedError) Is(target error) bool {
+	return target == ErrConnectionEnded
+}
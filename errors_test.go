@@ -0,0 +1,99 @@
+package sonic_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stevecallear/sonic"
+)
+
+func TestSonicError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		is       error
+		code     string
+		message  string
+	}{
+		{
+			name:     "should map authentication failures",
+			response: "ERR authentication_failed",
+			is:       sonic.ErrUnauthorized,
+			code:     "authentication_failed",
+			message:  "authentication_failed",
+		},
+		{
+			name:     "should map unknown commands",
+			response: "ERR unknown_command",
+			is:       sonic.ErrUnknownCommand,
+			code:     "unknown_command",
+			message:  "unknown_command",
+		},
+		{
+			name:     "should map invalid formats",
+			response: "ERR invalid_format(PING)",
+			is:       sonic.ErrInvalidFormat,
+			code:     "invalid_format",
+			message:  "invalid_format(PING)",
+		},
+		{
+			name:     "should map buffer overflows",
+			response: "ERR buffer_overflow",
+			is:       sonic.ErrBufferOverflow,
+			code:     "buffer_overflow",
+			message:  "buffer_overflow",
+		},
+		{
+			name:     "should map policy rejections",
+			response: "ERR policy_reject(reason)",
+			is:       sonic.ErrPolicyReject,
+			code:     "policy_reject",
+			message:  "policy_reject(reason)",
+		},
+		{
+			name:     "should fall back for unknown reasons",
+			response: "ERR something_new",
+			code:     "something_new",
+			message:  "something_new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer()
+			s.ConfigureStart("control", 20000)
+			s.On("^PING$").Send(tt.response)
+
+			s.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				c := sonic.NewControl(sonic.Options{
+					Password: "password",
+				})
+				defer c.Close()
+
+				err := c.Ping()
+
+				var se *sonic.SonicError
+				if !errors.As(err, &se) {
+					t.Fatalf("got %T, expected %T", err, se)
+				}
+
+				AssertDeepEqual(t, se.Code, tt.code)
+				AssertDeepEqual(t, se.Error(), tt.message)
+
+				if tt.is != nil && !errors.Is(err, tt.is) {
+					t.Errorf("got %v, expected %v", err, tt.is)
+				}
+
+				if tt.is == nil && errors.Is(err, sonic.ErrUnknownCommand) {
+					t.Errorf("got %v, expected no match", err)
+				}
+			})
+		})
+	}
+}
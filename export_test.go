@@ -0,0 +1,13 @@
+package sonic
+
+// Split splits the text as a channel with the specified max bytes would
+func Split(maxBytes int, s string, overhead int) []string {
+	c := &channel{maxBytes: maxBytes, terminator: DefaultLineTerminator}
+	return c.Split(s, overhead)
+}
+
+// SplitFunc splits the text as a channel with the specified max bytes would
+func SplitFunc(maxBytes int, s string, overhead int, fn func(chunk string) error) error {
+	c := &channel{maxBytes: maxBytes, terminator: DefaultLineTerminator}
+	return c.SplitFunc(s, overhead, fn)
+}
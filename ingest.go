@@ -1,9 +1,16 @@
 package sonic
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/stevecallear/sonic/pool"
 )
@@ -12,6 +19,7 @@ type (
 	// Ingest represents an ingest client
 	Ingest struct {
 		*client
+		validateUTF8 bool
 	}
 
 	// PushRequest represents a PUSH request
@@ -20,7 +28,7 @@ type (
 		Bucket     string
 		Object     string
 		Text       string
-		Lang       string // optional
+		Lang       Lang // optional
 	}
 
 	// PopRequest represents a POP request
@@ -38,144 +46,634 @@ type (
 		Object     string // optional
 	}
 
+	// CountResult represents the COUNT results for each level
+	CountResult struct {
+		Collection int
+		Bucket     int
+		Object     int
+	}
+
 	// FlushRequest represents a FLUSH request
 	FlushRequest struct {
 		Collection string
 		Bucket     string // optional
 		Object     string // optional
 	}
+
+	// PushError represents a failed push, including the number of text chunks
+	// that were acknowledged before the failure
+	PushError struct {
+		ChunksWritten int
+		Err           error
+	}
+
+	// BulkPushError represents a set of failed requests in a bulk push, keyed
+	// by request index
+	BulkPushError struct {
+		Errors map[int]error
+	}
+
+	// splitter splits text consistently for the duration of an operation, even
+	// if it is retried on a replacement channel with a different buffer size
+	splitter struct {
+		maxBytes int
+	}
+)
+
+var (
+	// ErrEmptyText indicates that the request text is empty
+	ErrEmptyText = errors.New("empty text")
+
+	// ErrInvalidUTF8 indicates that the request text is not valid UTF-8
+	ErrInvalidUTF8 = errors.New("invalid utf-8 text")
+)
+
+const (
+	// pushDepth is the maximum number of PUSH commands written before their
+	// responses are read
+	pushDepth = 64
+
+	// readerBufferSize is the number of bytes read from a reader per push
+	readerBufferSize = 64 * 1024
 )
 
 // NewIngest returns a new ingest client
 func NewIngest(o Options) *Ingest {
 	return &Ingest{
-		client: newClient("ingest", o),
+		client:       newClient("ingest", o),
+		validateUTF8: o.ValidateUTF8,
 	}
 }
 
-// Push pushes search data to the index
+// Push pushes search data to the index. Errors that occur once the text has
+// started to be pushed are returned as a *PushError.
 func (i *Ingest) Push(r PushRequest) error {
-	return i.pool.Exec(func(c pool.Channel) error {
-		for _, t := range c.Split(r.Text) {
-			msg := fmt.Sprintf("PUSH %s %s %s \"%s\"", r.Collection, r.Bucket, r.Object, c.Escape(t))
-			msg = appendLang(msg, r.Lang)
+	return i.PushContext(context.Background(), r)
+}
 
-			err := c.Write(msg)
+// PushContext pushes search data to the index using the specified context.
+// Errors that occur once the text has started to be pushed are returned as a
+// *PushError.
+func (i *Ingest) PushContext(ctx context.Context, r PushRequest) (err error) {
+	ctx, op := i.start(ctx, "PUSH", r.Collection, r.Bucket)
+	defer func() { op.end(err) }()
+
+	if err := i.validatePush(r); err != nil {
+		return err
+	}
+
+	sp := new(splitter)
+	err = i.pool.ExecContext(ctx, func(c pool.Channel) error {
+		_, err := withContext(ctx, c, func() (interface{}, error) {
+			n, err := push(c, r, sp)
 			if err != nil {
-				return err
+				return nil, &PushError{ChunksWritten: n, Err: err}
 			}
+			return nil, nil
+		})
+		return err
+	})
 
-			// OK
-			_, err = c.Read()
-			if err != nil {
+	var pe *PushError
+	if errors.As(err, &pe) {
+		pe.Err = contextErr(ctx, pe.Err)
+		return pe
+	}
+
+	return contextErr(ctx, err)
+}
+
+// BulkPush pushes multiple search data requests to the index using a single
+// connection. Failed requests do not prevent the remaining requests from being
+// pushed and are returned as a *BulkPushError.
+// If the connection fails, the failed request and all subsequent requests are
+// reported with the connection error. If the batch is retried then only the
+// errors from the final attempt are reported.
+func (i *Ingest) BulkPush(rs []PushRequest) (err error) {
+	_, op := i.start(context.Background(), "BULKPUSH", "", "")
+	defer func() { op.end(err) }()
+
+	var errs map[int]error
+	sp := new(splitter)
+
+	err = i.pool.Exec(func(c pool.Channel) error {
+		errs = map[int]error{}
+		for idx, r := range rs {
+			if err := i.validatePush(r); err != nil {
+				errs[idx] = err
+				continue
+			}
+
+			_, err := push(c, r, sp)
+			if err == nil {
+				continue
+			}
+
+			errs[idx] = err
+			if !isRecoverable(err) {
+				// the connection cannot be used for the remaining requests
+				for n := idx + 1; n < len(rs); n++ {
+					errs[n] = err
+				}
 				return err
 			}
 		}
 
 		return nil
 	})
+	if err != nil && len(errs) == 0 {
+		// the connection could not be acquired
+		return err
+	}
+
+	if len(errs) > 0 {
+		return &BulkPushError{Errors: errs}
+	}
+
+	return nil
 }
 
-// Pop pops search data from the index
-func (i *Ingest) Pop(r PopRequest) (int, error) {
-	res, err := i.pool.Query(func(c pool.Channel) (interface{}, error) {
-		var nt int
-		for _, t := range c.Split(r.Text) {
-			err := c.Write(fmt.Sprintf("POP %s %s %s \"%s\"", r.Collection, r.Bucket, r.Object, c.Escape(t)))
-			if err != nil {
-				return nt, err
+// Error returns the error message
+func (e *PushError) Error() string {
+	return fmt.Sprintf("push: %d chunks written: %v", e.ChunksWritten, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns the error message
+func (e *BulkPushError) Error() string {
+	idxs := make([]int, 0, len(e.Errors))
+	for idx := range e.Errors {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+
+	msgs := make([]string, len(idxs))
+	for n, idx := range idxs {
+		msgs[n] = fmt.Sprintf("request %d: %v", idx, e.Errors[idx])
+	}
+
+	return fmt.Sprintf("bulk push: %d failed: %s", len(idxs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the underlying request errors
+func (e *BulkPushError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// PushReader pushes search data read from r to the index using a single
+// connection. The data is read and pushed incrementally, so the reader is never
+// held in memory in its entirety. As the reader cannot be replayed, the push
+// is not retried if the connection fails.
+func (i *Ingest) PushReader(coll, bucket, object string, r io.Reader, lang Lang) (err error) {
+	_, op := i.start(context.Background(), "PUSH", coll, bucket)
+	defer func() { op.end(err) }()
+
+	if err := validateRequired(coll, bucket, object); err != nil {
+		return err
+	}
+
+	if err := lang.Validate(); err != nil {
+		return err
+	}
+
+	var rerr error
+	var total int
+	sp := new(splitter)
+
+	err = i.pool.Exec(func(c pool.Channel) error {
+		req := PushRequest{
+			Collection: coll,
+			Bucket:     bucket,
+			Object:     object,
+			Lang:       lang,
+		}
+
+		buf := make([]byte, readerBufferSize)
+		var n int
+		for {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			total += m
+
+			eof := err == io.EOF || err == io.ErrUnexpectedEOF
+			if err != nil && !eof {
+				// reader errors do not affect the channel
+				rerr = err
+				return nil
 			}
 
-			// RESULT <n>
-			res, err := c.Read()
-			if err != nil {
-				return nt, err
+			end := n
+			if !eof {
+				end = textBoundary(buf[:n])
 			}
 
-			n, err := strconv.Atoi(strings.Split(res, " ")[1])
-			if err != nil {
-				return nt, ErrInvalidResponse
+			if end > 0 {
+				// invalid text does not affect the channel
+				if i.validateUTF8 && !utf8.Valid(buf[:end]) {
+					rerr = ErrInvalidUTF8
+					return nil
+				}
+
+				// the reader cannot be replayed, so the push is not retried
+				req.Text = string(buf[:end])
+				if _, err := push(c, req, sp); err != nil {
+					return pool.NoRetry(err)
+				}
 			}
 
-			nt += n
+			n = copy(buf, buf[end:n])
+			if eof {
+				return nil
+			}
 		}
-
-		return nt, nil
 	})
 	if err != nil {
+		return err
+	}
+
+	if rerr != nil {
+		return rerr
+	}
+
+	if total == 0 {
+		return ErrEmptyText
+	}
+
+	return nil
+}
+
+// Pop pops search data from the index
+func (i *Ingest) Pop(r PopRequest) (int, error) {
+	return i.PopContext(context.Background(), r)
+}
+
+// PopContext pops search data from the index using the specified context
+func (i *Ingest) PopContext(ctx context.Context, r PopRequest) (count int, err error) {
+	ctx, op := i.start(ctx, "POP", r.Collection, r.Bucket)
+	defer func() { op.end(err, attrResults.Int(count)) }()
+
+	if err := validateRequired(r.Collection, r.Bucket, r.Object); err != nil {
 		return 0, err
 	}
 
+	if r.Text == "" {
+		return 0, ErrEmptyText
+	}
+
+	sp := new(splitter)
+	res, err := i.pool.QueryContext(ctx, func(c pool.Channel) (interface{}, error) {
+		return withContext(ctx, c, func() (interface{}, error) {
+			cmd := func(t string) string {
+				return newCommand(len(t)+3, "POP", r.Collection, r.Bucket, r.Object).text(t).String()
+			}
+
+			var nt int
+			err := sp.split(c, r.Text, len(cmd("")), func(t string) error {
+				err := c.Write(cmd(Escape(t)))
+				if err != nil {
+					return err
+				}
+
+				// RESULT <n>
+				res, err := c.Read()
+				if err != nil {
+					return err
+				}
+
+				n, err := parseResult(res)
+				if err != nil {
+					return err
+				}
+
+				nt += n
+				return nil
+			})
+
+			return nt, err
+		})
+	})
+	if err != nil {
+		return 0, contextErr(ctx, err)
+	}
+
 	return res.(int), nil
 }
 
 // Count counts indexed search data
 func (i *Ingest) Count(r CountRequest) (int, error) {
-	res, err := i.pool.Query(func(c pool.Channel) (interface{}, error) {
-		var msg string
-		switch {
-		case r.Bucket != "" && r.Object != "":
-			msg = fmt.Sprintf("COUNT %s %s %s", r.Collection, r.Bucket, r.Object)
-		case r.Bucket != "":
-			msg = fmt.Sprintf("COUNT %s %s", r.Collection, r.Bucket)
-		default:
-			msg = fmt.Sprintf("COUNT %s", r.Collection)
+	return i.CountContext(context.Background(), r)
+}
+
+// CountContext counts indexed search data using the specified context
+func (i *Ingest) CountContext(ctx context.Context, r CountRequest) (count int, err error) {
+	ctx, op := i.start(ctx, "COUNT", r.Collection, r.Bucket)
+	defer func() { op.end(err, attrResults.Int(count)) }()
+
+	if err := validateLevel(r.Collection, r.Bucket, r.Object); err != nil {
+		return 0, err
+	}
+
+	res, err := i.pool.QueryContext(ctx, func(c pool.Channel) (interface{}, error) {
+		return withContext(ctx, c, func() (interface{}, error) {
+			switch {
+			case r.Bucket != "" && r.Object != "":
+				return countLevel(c, r.Collection, r.Bucket, r.Object)
+			case r.Bucket != "":
+				return countLevel(c, r.Collection, r.Bucket)
+			default:
+				return countLevel(c, r.Collection)
+			}
+		})
+	})
+	if err != nil {
+		return 0, contextErr(ctx, err)
+	}
+
+	return res.(int), nil
+}
+
+// CountAll counts indexed search data at the collection, bucket and object
+// levels using a single connection. Levels with an empty identifier are not
+// counted, and the object is only counted if the bucket is specified.
+func (i *Ingest) CountAll(coll, bucket, object string) (res CountResult, err error) {
+	_, op := i.start(context.Background(), "COUNT", coll, bucket)
+	defer func() { op.end(err, attrResults.Int(res.Collection)) }()
+
+	if err := validateLevel(coll, bucket, object); err != nil {
+		return CountResult{}, err
+	}
+
+	err = i.pool.Exec(func(c pool.Channel) error {
+		var err error
+		if res.Collection, err = countLevel(c, coll); err != nil {
+			return err
 		}
 
-		err := c.Write(msg)
-		if err != nil {
-			return nil, err
+		if bucket == "" {
+			return nil
 		}
 
-		// RESULT <count>
-		res, err := c.Read()
-		if err != nil {
-			return nil, err
+		if res.Bucket, err = countLevel(c, coll, bucket); err != nil {
+			return err
 		}
 
-		n, err := strconv.Atoi(strings.Split(res, " ")[1])
-		if err != nil {
-			return 0, ErrInvalidResponse
+		if object == "" {
+			return nil
 		}
 
-		return n, nil
+		res.Object, err = countLevel(c, coll, bucket, object)
+		return err
 	})
 	if err != nil {
-		return 0, err
+		return CountResult{}, err
 	}
 
-	return res.(int), nil
+	return res, nil
 }
 
 // Flush flushes all indexed data from a collection, bucket or object
 func (i *Ingest) Flush(r FlushRequest) (int, error) {
-	res, err := i.pool.Query(func(c pool.Channel) (interface{}, error) {
-		var msg string
-		switch {
-		case r.Bucket != "" && r.Object != "":
-			msg = fmt.Sprintf("FLUSHO %s %s %s", r.Collection, r.Bucket, r.Object)
-		case r.Bucket != "":
-			msg = fmt.Sprintf("FLUSHB %s %s", r.Collection, r.Bucket)
-		default:
-			msg = fmt.Sprintf("FLUSHC %s", r.Collection)
-		}
+	return i.FlushContext(context.Background(), r)
+}
 
-		err := c.Write(msg)
+// FlushContext flushes all indexed data from a collection, bucket or object
+// using the specified context
+func (i *Ingest) FlushContext(ctx context.Context, r FlushRequest) (count int, err error) {
+	ctx, op := i.start(ctx, "FLUSH", r.Collection, r.Bucket)
+	defer func() { op.end(err, attrResults.Int(count)) }()
+
+	if err := validateLevel(r.Collection, r.Bucket, r.Object); err != nil {
+		return 0, err
+	}
+
+	res, err := i.pool.QueryContext(ctx, func(c pool.Channel) (interface{}, error) {
+		return withContext(ctx, c, func() (interface{}, error) {
+			var msg string
+			switch {
+			case r.Bucket != "" && r.Object != "":
+				msg = newCommand(0, "FLUSHO", r.Collection, r.Bucket, r.Object).String()
+			case r.Bucket != "":
+				msg = newCommand(0, "FLUSHB", r.Collection, r.Bucket).String()
+			default:
+				msg = newCommand(0, "FLUSHC", r.Collection).String()
+			}
+
+			err := c.Write(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			// RESULT <count>
+			res, err := c.Read()
+			if err != nil {
+				return nil, err
+			}
+
+			return parseResult(res)
+		})
+	})
+	if err != nil {
+		return 0, contextErr(ctx, err)
+	}
+
+	return res.(int), nil
+}
+
+// Reindex replaces the indexed search data for an object by flushing the
+// object and pushing the text using a single connection
+func (i *Ingest) Reindex(coll, bucket, object, text string, lang Lang) (err error) {
+	_, op := i.start(context.Background(), "REINDEX", coll, bucket)
+	defer func() { op.end(err) }()
+
+	r := PushRequest{
+		Collection: coll,
+		Bucket:     bucket,
+		Object:     object,
+		Text:       text,
+		Lang:       lang,
+	}
+
+	if err := i.validatePush(r); err != nil {
+		return err
+	}
+
+	sp := new(splitter)
+	return i.pool.Exec(func(c pool.Channel) error {
+		err := c.Write(newCommand(0, "FLUSHO", coll, bucket, object).String())
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// RESULT <count>
 		res, err := c.Read()
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if _, err := parseResult(res); err != nil {
+			return err
+		}
+
+		_, err = push(c, r, sp)
+		return err
+	})
+}
+
+func (i *Ingest) validatePush(r PushRequest) error {
+	if err := validateRequired(r.Collection, r.Bucket, r.Object); err != nil {
+		return err
+	}
+
+	if r.Text == "" {
+		return ErrEmptyText
+	}
+
+	if i.validateUTF8 && !utf8.ValidString(r.Text) {
+		return ErrInvalidUTF8
+	}
+
+	return r.Lang.Validate()
+}
+
+// push writes the text chunks before reading their acknowledgements, limiting
+// the number of unread responses to pushDepth. The channel is discarded if the
+// responses can no longer be matched to their commands. The number of chunks
+// acknowledged before the first error is returned.
+func push(c pool.Channel, r PushRequest, sp *splitter) (int, error) {
+	cmd := func(t string) string {
+		return newCommand(len(t)+len(r.Lang)+10, "PUSH", r.Collection, r.Bucket, r.Object).
+			text(t).
+			param("LANG", string(r.Lang)).
+			String()
+	}
+
+	var written, pending int
+
+	// ack reads the responses for the pending chunks
+	ack := func() error {
+		var perr error
+		for ; pending > 0; pending-- {
+			err := readOK(c)
+			if err == nil {
+				if perr == nil {
+					written++
+				}
+				continue
+			}
+
+			if !isRecoverable(err) {
+				return pool.Discard(err)
+			}
+
+			// continue reading so that the pending responses are consumed
+			if perr == nil {
+				perr = err
+			}
+		}
+
+		return perr
+	}
+
+	err := sp.split(c, r.Text, len(cmd("")), func(t string) error {
+		err := c.Write(cmd(Escape(t)))
+		if err != nil {
+			return pool.Discard(err)
+		}
+
+		if pending++; pending < pushDepth {
+			return nil
 		}
 
-		return strconv.Atoi(strings.Split(res, " ")[1])
+		return ack()
 	})
+	if err != nil {
+		return written, err
+	}
+
+	return written, ack()
+}
+
+// split splits the text using the limit of the first channel that the
+// splitter is used with
+func (s *splitter) split(c pool.Channel, text string, overhead int, fn func(chunk string) error) error {
+	ch, ok := c.(*channel)
+	if !ok {
+		return c.SplitFunc(text, overhead, fn)
+	}
+
+	if s.maxBytes == 0 {
+		s.maxBytes = ch.maxBytes
+	}
+
+	return splitFunc(text, s.maxBytes-overhead-len(ch.terminator), fn)
+}
+
+// textBoundary returns the index following the last whitespace in b, or the
+// last complete rune if there is no whitespace
+func textBoundary(b []byte) int {
+	if i := bytes.LastIndexFunc(b, unicode.IsSpace); i >= 0 {
+		_, n := utf8.DecodeRune(b[i:])
+		return i + n
+	}
+
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+
+	return len(b)
+}
+
+// validateLevel validates the identifiers for a collection, bucket or object
+// level, returning ErrInvalidIdentifier if the collection is empty
+func validateLevel(coll, bucket, object string) error {
+	if coll == "" {
+		return ErrInvalidIdentifier
+	}
+
+	return validateIdentifiers(coll, bucket, object)
+}
+
+// countLevel writes a COUNT command with the specified identifiers and returns
+// the result
+func countLevel(c pool.Channel, ids ...string) (int, error) {
+	err := c.Write(newCommand(0, "COUNT", ids...).String())
 	if err != nil {
 		return 0, err
 	}
 
-	return res.(int), nil
+	// RESULT <count>
+	res, err := c.Read()
+	if err != nil {
+		return 0, err
+	}
+
+	return parseResult(res)
+}
+
+func parseResult(res string) (int, error) {
+	f := strings.Split(res, " ")
+	if len(f) < 2 {
+		return 0, ErrInvalidResponse
+	}
+
+	n, err := strconv.Atoi(f[1])
+	if err != nil {
+		return 0, ErrInvalidResponse
+	}
+
+	return n, nil
 }
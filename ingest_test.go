@@ -1,11 +1,18 @@
 package sonic_test
 
 import (
+	"context"
 	"errors"
+	"io"
 	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/pool"
+	"github.com/stevecallear/sonic/sonictest"
 )
 
 func TestNewIngest(t *testing.T) {
@@ -65,7 +72,56 @@ func TestIngest_Push(t *testing.T) {
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
 			connErr: ErrConnect,
-			err:     ErrConnect,
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: ErrConnect,
+		},
+		{
+			name:  "should return an error if the text is empty",
+			setup: func(*Server) {},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+			},
+			err: sonic.ErrEmptyText,
+		},
+		{
+			name:  "should return an error if the lang is invalid",
+			setup: func(*Server) {},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+				Lang:       "english",
+			},
+			err: sonic.ErrInvalidLang,
+		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.PushRequest{
+				Collection: "my collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return an error if the object is empty",
+			setup: func(*Server) {},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidIdentifier,
 		},
 		{
 			name: "should return push errors",
@@ -79,7 +135,35 @@ func TestIngest_Push(t *testing.T) {
 				Object:     "object",
 				Text:       "text",
 			},
-			err: errors.New("PUSH"),
+			err: &sonic.SonicError{Code: "PUSH"},
+		},
+		{
+			name: "should return an error if the session is ended",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PUSH").Send("ENDED shutdown")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrConnectionEnded,
+		},
+		{
+			name: "should return an error if the response is not ok",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PUSH").Send("RESULT 5")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidResponse,
 		},
 		{
 			name: "should push the text",
@@ -108,10 +192,24 @@ func TestIngest_Push(t *testing.T) {
 				Lang:       "eng",
 			},
 		},
+		{
+			name: "should disable language detection",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "text" LANG\(none\)$`).Send("OK")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+				Lang:       sonic.LangNone,
+			},
+		},
 		{
 			name: "should split long text",
 			setup: func(s *Server) {
-				s.ConfigureStart("ingest", 40) // 5 runes * 4 bytes * 2 = 40
+				s.ConfigureStart("ingest", 78) // (78 * 0.5) - 34 overhead bytes = 5 text bytes
 				s.On(`^PUSH collection bucket object "long "$`).Send("OK")
 				s.On(`^PUSH collection bucket object "text"$`).Send("OK")
 			},
@@ -135,6 +233,63 @@ func TestIngest_Push(t *testing.T) {
 				Text:       "\\ \n \" \\",
 			},
 		},
+		{
+			name: "should escape tabs and carriage returns",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "a\\tb\\r\\n"$`).Send("OK")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "a\tb\r\n",
+			},
+		},
+		{
+			name: "should split text on whitespace",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 92) // (92 * 0.5) - 34 overhead bytes = 12 text bytes
+				s.On(`^PUSH collection bucket object "the quick "$`).Send("OK")
+				s.On(`^PUSH collection bucket object "brown fox"$`).Send("OK")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "the quick brown fox",
+			},
+		},
+		{
+			name: "should force split long tokens",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 78) // (78 * 0.5) - 34 overhead bytes = 5 text bytes
+				s.On(`^PUSH collection bucket object "a "$`).Send("OK")
+				s.On(`^PUSH collection bucket object "veryl"$`).Send("OK")
+				s.On(`^PUSH collection bucket object "ongto"$`).Send("OK")
+				s.On(`^PUSH collection bucket object "ken b"$`).Send("OK")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "a verylongtoken b",
+			},
+		},
+		{
+			name: "should escape each chunk after splitting",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 82) // (82 * 0.5) - 34 overhead bytes = 7 escaped text bytes
+				s.On(`^PUSH collection bucket object "\\"ab\\" "$`).Send("OK")
+				s.On(`^PUSH collection bucket object "c\\\\d"$`).Send("OK")
+			},
+			request: sonic.PushRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "\"ab\" c\\d",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -160,6 +315,108 @@ func TestIngest_Push(t *testing.T) {
 	}
 }
 
+func TestIngest_BulkPush(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*Server)
+		connErr  error
+		requests []sonic.PushRequest
+		err      error
+		errs     map[int]error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			requests: []sonic.PushRequest{
+				{Collection: "collection", Bucket: "bucket", Object: "object", Text: "text"},
+			},
+			err: ErrConnect,
+		},
+		{
+			name: "should push each request",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object1 "text1"$`).Send("OK")
+				s.On(`^PUSH collection bucket object2 "text2" LANG\(eng\)$`).Send("OK")
+			},
+			requests: []sonic.PushRequest{
+				{Collection: "collection", Bucket: "bucket", Object: "object1", Text: "text1"},
+				{Collection: "collection", Bucket: "bucket", Object: "object2", Text: "text2", Lang: "eng"},
+			},
+		},
+		{
+			name: "should continue after failed requests",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object1 "text1"$`).Send("OK")
+				s.On(`^PUSH collection bucket object2 "text2"$`).Send("ERR PUSH")
+				s.On(`^PUSH collection bucket object4 "text4"$`).Send("OK")
+			},
+			requests: []sonic.PushRequest{
+				{Collection: "collection", Bucket: "bucket", Object: "object1", Text: "text1"},
+				{Collection: "collection", Bucket: "bucket", Object: "object2", Text: "text2"},
+				{Collection: "collection", Bucket: "bucket", Object: "object 3", Text: "text3"},
+				{Collection: "collection", Bucket: "bucket", Object: "object4", Text: "text4"},
+				{Collection: "collection", Bucket: "bucket", Object: "object5"},
+			},
+			errs: map[int]error{
+				1: errors.New("PUSH"),
+				2: sonic.ErrInvalidIdentifier,
+				4: sonic.ErrEmptyText,
+			},
+		},
+		{
+			name: "should split long text within the batch",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 80) // (80 * 0.5) - 35 overhead bytes = 5 text bytes
+				s.On(`^PUSH collection bucket object1 "long "$`).Send("OK")
+				s.On(`^PUSH collection bucket object1 "text"$`).Send("OK")
+				s.On(`^PUSH collection bucket object2 "short"$`).Send("OK")
+			},
+			requests: []sonic.PushRequest{
+				{Collection: "collection", Bucket: "bucket", Object: "object1", Text: "long text"},
+				{Collection: "collection", Bucket: "bucket", Object: "object2", Text: "short"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+				})
+				defer ingest.Close()
+
+				err := ingest.BulkPush(tt.requests)
+				if tt.errs == nil {
+					AssertError(t, err, tt.err)
+					return
+				}
+
+				var berr *sonic.BulkPushError
+				if !errors.As(err, &berr) {
+					t.Fatalf("got %v, expected a bulk push error", err)
+				}
+
+				AssertEqual(t, len(berr.Errors), len(tt.errs))
+				for idx, exp := range tt.errs {
+					AssertError(t, berr.Errors[idx], exp)
+				}
+			})
+		})
+	}
+}
+
 func TestIngest_Pop(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -173,7 +430,44 @@ func TestIngest_Pop(t *testing.T) {
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
 			connErr: ErrConnect,
-			err:     ErrConnect,
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: ErrConnect,
+		},
+		{
+			name:  "should return an error if the text is empty",
+			setup: func(*Server) {},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+			},
+			err: sonic.ErrEmptyText,
+		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket\n",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return an error if the bucket is empty",
+			setup: func(*Server) {},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidIdentifier,
 		},
 		{
 			name: "should return pop errors",
@@ -203,6 +497,34 @@ func TestIngest_Pop(t *testing.T) {
 			},
 			err: sonic.ErrInvalidResponse,
 		},
+		{
+			name: "should return an error if the result has no count",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^POP").Send("RESULT")
+			},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return an error if the result is empty",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^POP").Send("")
+			},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "text",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should pop the text",
 			setup: func(s *Server) {
@@ -220,7 +542,7 @@ func TestIngest_Pop(t *testing.T) {
 		{
 			name: "should split long text",
 			setup: func(s *Server) {
-				s.ConfigureStart("ingest", 40) // 5 runes * 4 bytes * 2 = 40
+				s.ConfigureStart("ingest", 76) // (76 * 0.5) - 33 overhead bytes = 5 text bytes
 				s.On(`^POP collection bucket object "long "$`).Send("RESULT 3")
 				s.On(`^POP collection bucket object "text"$`).Send("RESULT 7")
 			},
@@ -246,6 +568,21 @@ func TestIngest_Pop(t *testing.T) {
 			},
 			exp: 10,
 		},
+		{
+			name: "should escape each chunk after splitting",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 80) // (80 * 0.5) - 33 overhead bytes = 7 escaped text bytes
+				s.On(`^POP collection bucket object "\\"ab\\" "$`).Send("RESULT 3")
+				s.On(`^POP collection bucket object "c\\\\d"$`).Send("RESULT 7")
+			},
+			request: sonic.PopRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "object",
+				Text:       "\"ab\" c\\d",
+			},
+			exp: 10,
+		},
 	}
 
 	for _, tt := range tests {
@@ -284,9 +621,26 @@ func TestIngest_Count(t *testing.T) {
 		{
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
+			request: sonic.CountRequest{Collection: "collection"},
 			connErr: ErrConnect,
 			err:     ErrConnect,
 		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.CountRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Object:     "ob\"ject",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:    "should return an error if the collection is empty",
+			setup:   func(*Server) {},
+			request: sonic.CountRequest{Bucket: "bucket"},
+			err:     sonic.ErrInvalidIdentifier,
+		},
 		{
 			name: "should return count errors",
 			setup: func(s *Server) {
@@ -309,6 +663,28 @@ func TestIngest_Count(t *testing.T) {
 			},
 			err: sonic.ErrInvalidResponse,
 		},
+		{
+			name: "should return an error if the result has no count",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT").Send("RESULT")
+			},
+			request: sonic.CountRequest{
+				Collection: "collection",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return an error if the result is empty",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT").Send("")
+			},
+			request: sonic.CountRequest{
+				Collection: "collection",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should count the collection",
 			setup: func(s *Server) {
@@ -371,13 +747,15 @@ func TestIngest_Count(t *testing.T) {
 	}
 }
 
-func TestIngest_Flush(t *testing.T) {
+func TestIngest_CountAll(t *testing.T) {
 	tests := []struct {
 		name    string
 		setup   func(*Server)
 		connErr error
-		request sonic.FlushRequest
-		exp     int
+		bucket  string
+		object  string
+		exp     sonic.CountResult
+		cmds    []string
 		err     error
 	}{
 		{
@@ -387,16 +765,192 @@ func TestIngest_Flush(t *testing.T) {
 			err:     ErrConnect,
 		},
 		{
-			name: "should return flush errors",
+			name:   "should return an error if an identifier is invalid",
+			setup:  func(*Server) {},
+			bucket: "my bucket",
+			err:    sonic.ErrInvalidIdentifier,
+		},
+		{
+			name: "should return count errors",
 			setup: func(s *Server) {
 				s.ConfigureStart("ingest", 20000)
-				s.On("^FLUSHC").Send("ERR FLUSHC")
+				s.On("^COUNT collection$").Send("RESULT 10")
+				s.On("^COUNT collection bucket$").Send("ERR COUNT")
+			},
+			bucket: "bucket",
+			object: "object",
+			cmds:   []string{"COUNT collection", "COUNT collection bucket"},
+			err:    errors.New("COUNT"),
+		},
+		{
+			name: "should count the collection",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT collection$").Send("RESULT 10")
+			},
+			exp:  sonic.CountResult{Collection: 10},
+			cmds: []string{"COUNT collection"},
+		},
+		{
+			name: "should count the collection and bucket",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT collection$").Send("RESULT 10")
+				s.On("^COUNT collection bucket$").Send("RESULT 5")
+			},
+			bucket: "bucket",
+			exp:    sonic.CountResult{Collection: 10, Bucket: 5},
+			cmds:   []string{"COUNT collection", "COUNT collection bucket"},
+		},
+		{
+			name: "should not count the object without the bucket",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT collection$").Send("RESULT 10")
+			},
+			object: "object",
+			exp:    sonic.CountResult{Collection: 10},
+			cmds:   []string{"COUNT collection"},
+		},
+		{
+			name: "should count all levels",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^COUNT collection$").Send("RESULT 10")
+				s.On("^COUNT collection bucket$").Send("RESULT 5")
+				s.On("^COUNT collection bucket object$").Send("RESULT 2")
+			},
+			bucket: "bucket",
+			object: "object",
+			exp:    sonic.CountResult{Collection: 10, Bucket: 5, Object: 2},
+			cmds: []string{
+				"COUNT collection",
+				"COUNT collection bucket",
+				"COUNT collection bucket object",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				var msgs []string
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+					LogFn: func(s string) {
+						if strings.HasPrefix(s, "COUNT") {
+							msgs = append(msgs, s)
+						}
+					},
+				})
+				defer ingest.Close()
+
+				act, err := ingest.CountAll("collection", tt.bucket, tt.object)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+				AssertDeepEqual(t, msgs, tt.cmds)
+			})
+		})
+	}
+
+	t.Run("should return an error if the collection is empty", func(t *testing.T) {
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			Dialer: func(context.Context, string) (net.Conn, error) {
+				t.Error("expected the command not to be sent")
+				return nil, ErrConnect
+			},
+		})
+		defer ingest.Close()
+
+		_, err := ingest.CountAll("", "bucket", "object")
+		AssertError(t, err, sonic.ErrInvalidIdentifier)
+	})
+}
+
+func TestIngest_Flush(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		request sonic.FlushRequest
+		exp     int
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			request: sonic.FlushRequest{Collection: "collection"},
+			connErr: ErrConnect,
+			err:     ErrConnect,
+		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.FlushRequest{
+				Collection: "collection",
+				Bucket:     "buck\tet",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:    "should return an error if the collection is empty",
+			setup:   func(*Server) {},
+			request: sonic.FlushRequest{},
+			err:     sonic.ErrInvalidIdentifier,
+		},
+		{
+			name: "should return flush errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHC").Send("ERR FLUSHC")
 			},
 			request: sonic.FlushRequest{
 				Collection: "collection",
 			},
 			err: errors.New("FLUSHC"),
 		},
+		{
+			name: "should return an error if the result cannot be parsed",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHC").Send("RESULT invalid")
+			},
+			request: sonic.FlushRequest{
+				Collection: "collection",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return an error if the result has no count",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHC").Send("RESULT")
+			},
+			request: sonic.FlushRequest{
+				Collection: "collection",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return an error if the result is empty",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHC").Send("")
+			},
+			request: sonic.FlushRequest{
+				Collection: "collection",
+			},
+			err: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should flush the collection",
 			setup: func(s *Server) {
@@ -459,6 +1013,120 @@ func TestIngest_Flush(t *testing.T) {
 	}
 }
 
+func TestIngest_Reindex(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		object  string
+		text    string
+		exp     []string
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			object:  "object",
+			text:    "text",
+			err:     ErrConnect,
+		},
+		{
+			name:   "should return an error if an identifier is invalid",
+			setup:  func(*Server) {},
+			object: "my object",
+			text:   "text",
+			err:    sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:   "should return an error if the text is empty",
+			setup:  func(*Server) {},
+			object: "object",
+			err:    sonic.ErrEmptyText,
+		},
+		{
+			name: "should not push if the flush fails",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHO").Send("ERR FLUSHO")
+			},
+			object: "object",
+			text:   "text",
+			exp:    []string{"FLUSHO collection bucket object"},
+			err:    errors.New("FLUSHO"),
+		},
+		{
+			name: "should return an error if the flush response is invalid",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHO").Send("OK")
+			},
+			object: "object",
+			text:   "text",
+			exp:    []string{"FLUSHO collection bucket object"},
+			err:    sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return push errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHO").Send("RESULT 1")
+				s.On("^PUSH").Send("ERR PUSH")
+			},
+			object: "object",
+			text:   "text",
+			exp: []string{
+				"FLUSHO collection bucket object",
+				`PUSH collection bucket object "text" LANG(eng)`,
+			},
+			err: errors.New("PUSH"),
+		},
+		{
+			name: "should flush the object then push the text",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^FLUSHO collection bucket object$").Send("RESULT 1")
+				s.On(`^PUSH collection bucket object "text" LANG\(eng\)$`).Send("OK")
+			},
+			object: "object",
+			text:   "text",
+			exp: []string{
+				"FLUSHO collection bucket object",
+				`PUSH collection bucket object "text" LANG(eng)`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				var msgs []string
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+					LogFn: func(s string) {
+						if strings.HasPrefix(s, "FLUSHO") || strings.HasPrefix(s, "PUSH") {
+							msgs = append(msgs, s)
+						}
+					},
+				})
+				defer ingest.Close()
+
+				err := ingest.Reindex("collection", "bucket", tt.object, tt.text, sonic.LangEnglish)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, msgs, tt.exp)
+			})
+		})
+	}
+}
+
 func TestIngest_Ping(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -480,6 +1148,14 @@ func TestIngest_Ping(t *testing.T) {
 			},
 			exp: errors.New("PING"),
 		},
+		{
+			name: "should return an error if the response is not pong",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PING$").Send("STARTED ingest protocol(1) buffer(20000)")
+			},
+			exp: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should ping the server",
 			setup: func(s *Server) {
@@ -511,3 +1187,598 @@ func TestIngest_Ping(t *testing.T) {
 		})
 	}
 }
+
+func TestIngest_PoolStats(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On("^PING$").Send("PONG")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			PoolSize: 2,
+		})
+		defer ingest.Close()
+
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 2})
+
+		err := ingest.Ping()
+		AssertError(t, err, nil)
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 2, CurSize: 1, Idle: 1})
+	})
+}
+
+func TestIngest_ResizePool(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On("^PING$").Send("PONG")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			PoolSize: 2,
+			Dialer:   sonictest.Dialer(conn),
+		})
+		defer ingest.Close()
+
+		err := ingest.Ping()
+		AssertError(t, err, nil)
+
+		ingest.ResizePool(4)
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 4, CurSize: 1, Idle: 1})
+
+		ingest.ResizePool(1)
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 1, CurSize: 1, Idle: 1})
+	})
+}
+
+func TestIngest_WarmUp(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		ingest := sonic.NewIngest(sonic.Options{
+			Password:    "password",
+			PoolSize:    2,
+			PoolMinIdle: 1,
+		})
+		defer ingest.Close()
+
+		err := ingest.WarmUp()
+		AssertError(t, err, nil)
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 2, CurSize: 1, Idle: 1})
+	})
+}
+
+func TestIngest_Push_Split(t *testing.T) {
+	text := strings.Repeat("mixed ascii 混合テキスト \"quoted\"\n", 20)
+	maxBytes := 100
+
+	server := NewServer()
+	server.ConfigureStart("ingest", maxBytes*2)
+	server.On(`^PUSH`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		msgs := []string{}
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			LogFn: func(s string) {
+				if strings.HasPrefix(s, "PUSH") {
+					msgs = append(msgs, s)
+				}
+			},
+		})
+		defer ingest.Close()
+
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       text,
+		})
+		AssertError(t, err, nil)
+
+		unescape := strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`)
+		prefix := `PUSH collection bucket object "`
+
+		var act string
+		for _, m := range msgs {
+			if n := len(m) + len("\r\n"); n > maxBytes {
+				t.Errorf("got %d bytes, expected at most %d", n, maxBytes)
+			}
+
+			act += unescape.Replace(strings.TrimSuffix(strings.TrimPrefix(m, prefix), `"`))
+		}
+
+		if len(msgs) < 2 {
+			t.Errorf("got %d chunks, expected more than one", len(msgs))
+		}
+
+		AssertDeepEqual(t, act, text)
+	})
+}
+
+func TestIngest_Push_Retry(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On(`^PUSH collection bucket object "aaaa "$`).Send("OK")
+	server.On(`^PUSH collection bucket object "bbbb "$`).Send("OK")
+	server.On(`^PUSH collection bucket object "cccc"$`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		// the first connection has a smaller buffer and fails on the first push
+		// (78 * 0.5) - 34 overhead bytes = 5 text bytes
+		conns := []net.Conn{DropConn("ingest", 78, 0), conn}
+		ingest := sonic.NewIngest(sonic.Options{
+			Password:   "password",
+			PoolSize:   1,
+			MaxRetries: 1,
+			Dialer: func(context.Context, string) (net.Conn, error) {
+				c := conns[0]
+				conns = conns[1:]
+				return c, nil
+			},
+		})
+		defer ingest.Close()
+
+		// the text should be split using the first buffer size on retry
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "aaaa bbbb cccc",
+		})
+		AssertError(t, err, nil)
+	})
+}
+
+func TestIngest_BulkPush_Retry(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On(`^PUSH collection bucket object1 "text"$`).Send("OK")
+	server.On(`^PUSH collection bucket object2 "text"$`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		conns := []net.Conn{DropConn("ingest", 20000, 0), conn}
+		ingest := sonic.NewIngest(sonic.Options{
+			Password:   "password",
+			MaxRetries: 1,
+			Dialer: func(context.Context, string) (net.Conn, error) {
+				c := conns[0]
+				conns = conns[1:]
+				return c, nil
+			},
+		})
+		defer ingest.Close()
+
+		// errors from the failed attempt should not be reported
+		err := ingest.BulkPush([]sonic.PushRequest{
+			{Collection: "collection", Bucket: "bucket", Object: "object1", Text: "text"},
+			{Collection: "collection", Bucket: "bucket", Object: "object2", Text: "text"},
+		})
+		AssertError(t, err, nil)
+	})
+}
+
+func TestIngest_Push_Pipeline(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 78) // (78 * 0.5) - 34 overhead bytes = 5 text bytes
+	server.On(`^PUSH`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		msgs := []string{}
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			LogFn: func(s string) {
+				if strings.HasPrefix(s, "PUSH") || s == "OK" {
+					msgs = append(msgs, s)
+				}
+			},
+		})
+		defer ingest.Close()
+
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "aaaa bbbb cccc",
+		})
+		AssertError(t, err, nil)
+
+		exp := []string{
+			`PUSH collection bucket object "aaaa "`,
+			`PUSH collection bucket object "bbbb "`,
+			`PUSH collection bucket object "cccc"`,
+			"OK",
+			"OK",
+			"OK",
+		}
+		AssertDeepEqual(t, msgs, exp)
+	})
+}
+
+func TestIngest_Push_PushError(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 78) // (78 * 0.5) - 34 overhead bytes = 5 text bytes
+	server.On(`^PUSH collection bucket object "aaaa "$`).Send("OK")
+	server.On(`^PUSH collection bucket object "bbbb "$`).Send("ERR PUSH")
+	server.On(`^PUSH collection bucket object "cccc"$`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+		})
+		defer ingest.Close()
+
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "aaaa bbbb cccc",
+		})
+		AssertError(t, err, &sonic.SonicError{Code: "PUSH"})
+
+		var pe *sonic.PushError
+		if !errors.As(err, &pe) {
+			t.Fatalf("got %T, expected *sonic.PushError", err)
+		}
+		AssertEqual(t, pe.ChunksWritten, 1)
+	})
+}
+
+func TestIngest_ValidateUTF8(t *testing.T) {
+	invalid := "text \xff\xfe"
+
+	tests := []struct {
+		name     string
+		setup    func(*Server)
+		validate bool
+		fn       func(*sonic.Ingest) error
+		err      error
+	}{
+		{
+			name: "should push invalid text if validation is disabled",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object`).Send("OK")
+			},
+			fn: func(i *sonic.Ingest) error {
+				return i.Push(sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       invalid,
+				})
+			},
+		},
+		{
+			name:     "should return an error if pushed text is invalid",
+			setup:    func(*Server) {},
+			validate: true,
+			fn: func(i *sonic.Ingest) error {
+				return i.Push(sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       invalid,
+				})
+			},
+			err: sonic.ErrInvalidUTF8,
+		},
+		{
+			name: "should push valid text if validation is enabled",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "混合テキスト"$`).Send("OK")
+			},
+			validate: true,
+			fn: func(i *sonic.Ingest) error {
+				return i.Push(sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       "混合テキスト",
+				})
+			},
+		},
+		{
+			name: "should return an error if read text is invalid",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+			},
+			validate: true,
+			fn: func(i *sonic.Ingest) error {
+				return i.PushReader("collection", "bucket", "object", strings.NewReader(invalid), "")
+			},
+			err: sonic.ErrInvalidUTF8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				ingest := sonic.NewIngest(sonic.Options{
+					Password:     "password",
+					ValidateUTF8: tt.validate,
+				})
+				defer ingest.Close()
+
+				err := tt.fn(ingest)
+				AssertError(t, err, tt.err)
+			})
+		})
+	}
+}
+
+func TestIngest_Push_Discard(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 78) // (78 * 0.5) - 34 overhead bytes = 5 text bytes
+	server.On(`^PUSH`).Send("RESULT 1")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+		})
+		defer ingest.Close()
+
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "aaaa bbbb",
+		})
+		AssertError(t, err, sonic.ErrInvalidResponse)
+		AssertDeepEqual(t, ingest.PoolStats(), pool.Stats{MaxSize: 1})
+	})
+}
+
+func TestIngest_PushReader(t *testing.T) {
+	readErr := errors.New("read")
+
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		object  string
+		reader  io.Reader
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			connErr: ErrConnect,
+			object:  "object",
+			reader:  strings.NewReader("text"),
+			err:     ErrConnect,
+		},
+		{
+			name:   "should return an error if an identifier is invalid",
+			setup:  func(*Server) {},
+			object: "my object",
+			reader: strings.NewReader("text"),
+			err:    sonic.ErrInvalidIdentifier,
+		},
+		{
+			name: "should return an error if the reader is empty",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+			},
+			object: "object",
+			reader: strings.NewReader(""),
+			err:    sonic.ErrEmptyText,
+		},
+		{
+			name: "should return reader errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+			},
+			object: "object",
+			reader: iotest.ErrReader(readErr),
+			err:    readErr,
+		},
+		{
+			name: "should return push errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On("^PUSH").Send("ERR PUSH")
+			},
+			object: "object",
+			reader: strings.NewReader("text"),
+			err:    errors.New("PUSH"),
+		},
+		{
+			name: "should push the text",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "text" LANG\(eng\)$`).Send("OK")
+			},
+			object: "object",
+			reader: strings.NewReader("text"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+				})
+				defer ingest.Close()
+
+				err := ingest.PushReader("collection", "bucket", tt.object, tt.reader, "eng")
+				AssertError(t, err, tt.err)
+			})
+		})
+	}
+}
+
+func TestIngest_PushReader_Retry(t *testing.T) {
+	var dials int
+	ingest := sonic.NewIngest(sonic.Options{
+		Password:   "password",
+		MaxRetries: 1,
+		Dialer: func(context.Context, string) (net.Conn, error) {
+			if dials++; dials > 1 {
+				t.Error("got a retry, expected the reader not to be replayed")
+				return nil, ErrConnect
+			}
+
+			// fail once part of the text has been pushed
+			return DropConn("ingest", 20000, 10), nil
+		},
+	})
+	defer ingest.Close()
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 5000) // ~220KB
+	err := ingest.PushReader("collection", "bucket", "object", strings.NewReader(text), "")
+	if err == nil {
+		t.Error("got nil, expected an error")
+	}
+}
+
+func TestIngest_PushReader_Stream(t *testing.T) {
+	text := strings.Repeat("streamed 混合テキスト \"text\"\n", 128*1024) // ~4MB
+	maxBytes := 10000
+
+	server := NewServer()
+	server.ConfigureStart("ingest", maxBytes*2)
+	server.On(`^PUSH`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		r := strings.NewReader(text)
+		unread := -1 // bytes remaining in the reader when the first chunk is pushed
+
+		msgs := []string{}
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			LogFn: func(s string) {
+				if strings.HasPrefix(s, "PUSH") {
+					if unread < 0 {
+						unread = r.Len()
+					}
+					msgs = append(msgs, s)
+				}
+			},
+		})
+		defer ingest.Close()
+
+		err := ingest.PushReader("collection", "bucket", "object", r, "")
+		AssertError(t, err, nil)
+
+		if unread <= 0 {
+			t.Errorf("got %d unread bytes, expected the reader to be pushed incrementally", unread)
+		}
+
+		unescape := strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`)
+		prefix := `PUSH collection bucket object "`
+
+		var act strings.Builder
+		for _, m := range msgs {
+			if n := len(m) + len("\r\n"); n > maxBytes {
+				t.Fatalf("got %d bytes, expected at most %d", n, maxBytes)
+			}
+
+			act.WriteString(unescape.Replace(strings.TrimSuffix(strings.TrimPrefix(m, prefix), `"`)))
+		}
+
+		// each text chunk is within the buffer, with at most one partial
+		// chunk per read
+		min := len(text) / maxBytes
+		max := 2 * min
+		if len(msgs) < min || len(msgs) > max {
+			t.Errorf("got %d chunks, expected between %d and %d", len(msgs), min, max)
+		}
+
+		if act.String() != text {
+			t.Error("got different text, expected the reader text")
+		}
+	})
+}
+
+func BenchmarkIngest_Push(b *testing.B) {
+	// a small buffer splits the text into pipelined chunks of ~60 bytes
+	l := ServeLoopback(b, 200)
+	defer l.Close()
+
+	var writes int64
+	ingest := sonic.NewIngest(sonic.Options{
+		Addr:     l.Addr().String(),
+		Password: "password",
+		Dialer:   CountingDialer(&writes),
+	})
+	defer ingest.Close()
+
+	r := sonic.PushRequest{
+		Collection: "collection",
+		Bucket:     "bucket",
+		Object:     "object",
+		Text:       strings.Repeat("the quick brown fox jumps over the lazy dog ", 50),
+	}
+
+	if err := ingest.Ping(); err != nil {
+		b.Fatal(err)
+	}
+
+	atomic.StoreInt64(&writes, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if err := ingest.Push(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&writes))/float64(b.N), "writes/op")
+}
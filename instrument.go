@@ -0,0 +1,85 @@
+package sonic
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// operation represents an instrumented command
+type operation struct {
+	cmd       string
+	span      trace.Span
+	start     time.Time
+	onCommand func(cmd string, d time.Duration, err error)
+}
+
+// tracerName is the instrumentation name used for command spans
+const tracerName = "github.com/stevecallear/sonic"
+
+var (
+	attrCommand    = attribute.Key("sonic.command")
+	attrCollection = attribute.Key("sonic.collection")
+	attrBucket     = attribute.Key("sonic.bucket")
+	attrAction     = attribute.Key("sonic.action")
+	attrResults    = attribute.Key("sonic.results")
+)
+
+// newTracer returns the tracer for the options, using the global provider if
+// none is specified
+func newTracer(o Options) trace.Tracer {
+	tp := o.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return tp.Tracer(tracerName)
+}
+
+// start starts an operation for the command with a client span, omitting empty
+// collection and bucket attributes
+func (c *client) start(ctx context.Context, cmd, coll, bucket string) (context.Context, *operation) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "sonic"),
+		attrCommand.String(cmd),
+	}
+	if coll != "" {
+		attrs = append(attrs, attrCollection.String(coll))
+	}
+	if bucket != "" {
+		attrs = append(attrs, attrBucket.String(bucket))
+	}
+
+	ctx, span := c.tracer.Start(ctx, "sonic "+cmd,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	return ctx, &operation{
+		cmd:       cmd,
+		span:      span,
+		start:     time.Now(),
+		onCommand: c.onCommand,
+	}
+}
+
+// end ends the operation, recording the error if there is one or the specified
+// attributes otherwise, and calls the command hook
+func (op *operation) end(err error, attrs ...attribute.KeyValue) {
+	d := time.Since(op.start)
+
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	} else {
+		op.span.SetAttributes(attrs...)
+	}
+	op.span.End()
+
+	if op.onCommand != nil {
+		op.onCommand(op.cmd, d, err)
+	}
+}
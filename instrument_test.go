@@ -0,0 +1,403 @@
+package sonic_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/sonictest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracerProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctype  string
+		setup  func(*Server)
+		fn     func(context.Context, sonic.Options) error
+		span   string
+		attrs  map[attribute.Key]attribute.Value
+		status codes.Code
+		child  bool
+		err    error
+	}{
+		{
+			name:  "should trace push",
+			ctype: "ingest",
+			setup: func(s *Server) {
+				s.On(`^PUSH collection bucket object "text"$`).Send("OK")
+			},
+			fn: func(ctx context.Context, o sonic.Options) error {
+				return sonic.NewIngest(o).PushContext(ctx, sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       "text",
+				})
+			},
+			span: "sonic PUSH",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":        attribute.StringValue("sonic"),
+				"sonic.command":    attribute.StringValue("PUSH"),
+				"sonic.collection": attribute.StringValue("collection"),
+				"sonic.bucket":     attribute.StringValue("bucket"),
+			},
+			status: codes.Unset,
+			child:  true,
+		},
+		{
+			name:  "should trace bulk push",
+			ctype: "ingest",
+			setup: func(s *Server) {
+				s.On(`^PUSH collection bucket object[12] "text"$`).Send("OK")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				return sonic.NewIngest(o).BulkPush([]sonic.PushRequest{
+					{Collection: "collection", Bucket: "bucket", Object: "object1", Text: "text"},
+					{Collection: "collection", Bucket: "bucket", Object: "object2", Text: "text"},
+				})
+			},
+			span: "sonic BULKPUSH",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("BULKPUSH"),
+			},
+			status: codes.Unset,
+		},
+		{
+			name:  "should trace push reader",
+			ctype: "ingest",
+			setup: func(s *Server) {
+				s.On(`^PUSH collection bucket object "text"$`).Send("OK")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				return sonic.NewIngest(o).PushReader("collection", "bucket", "object", strings.NewReader("text"), "")
+			},
+			span: "sonic PUSH",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":        attribute.StringValue("sonic"),
+				"sonic.command":    attribute.StringValue("PUSH"),
+				"sonic.collection": attribute.StringValue("collection"),
+				"sonic.bucket":     attribute.StringValue("bucket"),
+			},
+			status: codes.Unset,
+		},
+		{
+			name:  "should trace help",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.On(`^HELP$`).Send("RESULT manuals(commands)")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				_, err := sonic.NewSearch(o).Help("")
+				return err
+			},
+			span: "sonic HELP",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("HELP"),
+				"sonic.results": attribute.IntValue(1),
+			},
+			status: codes.Unset,
+		},
+		{
+			name:  "should trace raw commands",
+			ctype: "ingest",
+			setup: func(s *Server) {
+				s.On(`^FLUSHC collection$`).Send("RESULT 1")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				_, err := sonic.NewIngest(o).Do("FLUSHC collection")
+				return err
+			},
+			span: "sonic FLUSHC",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("FLUSHC"),
+			},
+			status: codes.Unset,
+		},
+		{
+			name:  "should trace ping latency",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.On(`^PING$`).Send("PONG")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				_, err := sonic.NewSearch(o).PingLatency()
+				return err
+			},
+			span: "sonic PING",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("PING"),
+			},
+			status: codes.Unset,
+		},
+		{
+			name:  "should trace health checks",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.On(`^PING$`).Send("PONG")
+			},
+			fn: func(ctx context.Context, o sonic.Options) error {
+				return sonic.NewSearch(o).HealthCheck(ctx)
+			},
+			span: "sonic HEALTHCHECK",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("HEALTHCHECK"),
+			},
+			status: codes.Unset,
+			child:  true,
+		},
+		{
+			name:  "should trace query results",
+			ctype: "search",
+			setup: func(s *Server) {
+				s.On(`^QUERY collection bucket "terms"$`).
+					Send("PENDING abc").
+					Send("EVENT QUERY abc o1 o2")
+			},
+			fn: func(ctx context.Context, o sonic.Options) error {
+				_, err := sonic.NewSearch(o).QueryContext(ctx, sonic.QueryRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Terms:      "terms",
+				})
+				return err
+			},
+			span: "sonic QUERY",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":        attribute.StringValue("sonic"),
+				"sonic.command":    attribute.StringValue("QUERY"),
+				"sonic.collection": attribute.StringValue("collection"),
+				"sonic.bucket":     attribute.StringValue("bucket"),
+				"sonic.results":    attribute.IntValue(2),
+			},
+			status: codes.Unset,
+			child:  true,
+		},
+		{
+			name:  "should record errors",
+			ctype: "control",
+			setup: func(s *Server) {
+				s.On(`^TRIGGER consolidate$`).Send("ERR consolidate")
+			},
+			fn: func(_ context.Context, o sonic.Options) error {
+				return sonic.NewControl(o).Consolidate()
+			},
+			span: "sonic TRIGGER",
+			attrs: map[attribute.Key]attribute.Value{
+				"db.system":     attribute.StringValue("sonic"),
+				"sonic.command": attribute.StringValue("TRIGGER"),
+				"sonic.action":  attribute.StringValue("consolidate"),
+			},
+			status: codes.Error,
+			err:    errors.New("consolidate"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			server.ConfigureStart(tt.ctype, 20000)
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				sr := tracetest.NewSpanRecorder()
+				tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+				ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+				err := tt.fn(ctx, sonic.Options{
+					Password:       "password",
+					Dialer:         sonictest.Dialer(conn),
+					TracerProvider: tp,
+				})
+				AssertError(t, err, tt.err)
+				parent.End()
+
+				spans := sr.Ended()
+				if len(spans) != 2 {
+					t.Fatalf("got %d spans, expected 2", len(spans))
+				}
+
+				span := spans[0]
+				AssertEqual(t, span.Name(), tt.span)
+				AssertEqual(t, span.Status().Code, tt.status)
+
+				attrs := map[attribute.Key]attribute.Value{}
+				for _, a := range span.Attributes() {
+					attrs[a.Key] = a.Value
+				}
+				AssertDeepEqual(t, attrs, tt.attrs)
+
+				if tt.child {
+					// the span is a child of the context span
+					AssertEqual(t, span.Parent().SpanID(), parent.SpanContext().SpanID())
+				}
+
+				if tt.status == codes.Error && len(span.Events()) != 1 {
+					t.Errorf("got %d events, expected the recorded error", len(span.Events()))
+				}
+			})
+		})
+	}
+}
+
+func TestOnCommand(t *testing.T) {
+	type call struct {
+		cmd string
+		err error
+	}
+
+	tests := []struct {
+		name  string
+		setup func(*Server)
+		fn    func(*sonic.Ingest) error
+		exp   []call
+	}{
+		{
+			name: "should call the hook on success",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "text"$`).Delay(10 * time.Millisecond).Send("OK")
+				s.On(`^COUNT collection$`).Send("RESULT 1")
+			},
+			fn: func(i *sonic.Ingest) error {
+				err := i.Push(sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       "text",
+				})
+				if err != nil {
+					return err
+				}
+
+				_, err = i.Count(sonic.CountRequest{Collection: "collection"})
+				return err
+			},
+			exp: []call{
+				{cmd: "PUSH"},
+				{cmd: "COUNT"},
+			},
+		},
+		{
+			name: "should call the hook on server errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^FLUSHC collection$`).Send("ERR flush")
+			},
+			fn: func(i *sonic.Ingest) error {
+				_, err := i.Flush(sonic.FlushRequest{Collection: "collection"})
+				return err
+			},
+			exp: []call{
+				{cmd: "FLUSH", err: errors.New("flush")},
+			},
+		},
+		{
+			name: "should call the hook for composite and raw commands",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket object "text"$`).Send("OK")
+				s.On(`^HELP$`).Send("RESULT manuals(commands)")
+				s.On(`^FLUSHC collection$`).Send("RESULT 1")
+				s.On(`^PING$`).Send("PONG")
+			},
+			fn: func(i *sonic.Ingest) error {
+				r := sonic.PushRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Object:     "object",
+					Text:       "text",
+				}
+
+				if err := i.BulkPush([]sonic.PushRequest{r}); err != nil {
+					return err
+				}
+
+				if err := i.PushReader("collection", "bucket", "object", strings.NewReader("text"), ""); err != nil {
+					return err
+				}
+
+				if _, err := i.Help(""); err != nil {
+					return err
+				}
+
+				if _, err := i.Do("FLUSHC collection"); err != nil {
+					return err
+				}
+
+				if _, err := i.PingLatency(); err != nil {
+					return err
+				}
+
+				return i.HealthCheck(context.Background())
+			},
+			exp: []call{
+				{cmd: "BULKPUSH"},
+				{cmd: "PUSH"},
+				{cmd: "HELP"},
+				{cmd: "FLUSHC"},
+				{cmd: "PING"},
+				{cmd: "HEALTHCHECK"},
+			},
+		},
+		{
+			name:  "should call the hook on validation errors",
+			setup: func(s *Server) {},
+			fn: func(i *sonic.Ingest) error {
+				_, err := i.Pop(sonic.PopRequest{Collection: "invalid collection"})
+				return err
+			},
+			exp: []call{
+				{cmd: "POP", err: sonic.ErrInvalidIdentifier},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				var calls []call
+				var durations []time.Duration
+
+				ingest := sonic.NewIngestWith("localhost:1491", "password",
+					sonic.WithDialer(sonictest.Dialer(conn)),
+					sonic.WithOnCommand(func(cmd string, d time.Duration, err error) {
+						calls = append(calls, call{cmd: cmd, err: err})
+						durations = append(durations, d)
+					}))
+				defer ingest.Close()
+
+				tt.fn(ingest)
+
+				if len(calls) != len(tt.exp) {
+					t.Fatalf("got %d calls, expected %d", len(calls), len(tt.exp))
+				}
+
+				for i, c := range calls {
+					AssertEqual(t, c.cmd, tt.exp[i].cmd)
+					AssertError(t, c.err, tt.exp[i].err)
+				}
+
+				if tt.exp[0].cmd == "PUSH" && durations[0] < 10*time.Millisecond {
+					t.Errorf("got %v, expected at least 10ms", durations[0])
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package sonic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Lang represents an ISO 639-3 language code. Codes recognised by Sonic that
+// have no constant can be specified using an explicit conversion, for example
+// Lang("ukr"), but any other value fails validation with ErrInvalidLang.
+type Lang string
+
+// LangNone disables language detection, for example when indexing codes or
+// identifiers that would otherwise be stemmed or filtered as stopwords
+const LangNone Lang = "none"
+
+// Common languages recognised by Sonic
+const (
+	LangArabic     Lang = "ara"
+	LangChinese    Lang = "cmn"
+	LangDutch      Lang = "nld"
+	LangEnglish    Lang = "eng"
+	LangFrench     Lang = "fra"
+	LangGerman     Lang = "deu"
+	LangHindi      Lang = "hin"
+	LangItalian    Lang = "ita"
+	LangJapanese   Lang = "jpn"
+	LangKorean     Lang = "kor"
+	LangPortuguese Lang = "por"
+	LangRussian    Lang = "rus"
+	LangSpanish    Lang = "spa"
+)
+
+// ErrInvalidLang indicates that a language code is not recognised by Sonic
+var ErrInvalidLang = errors.New("invalid lang")
+
+// langs holds the ISO 639-3 codes recognised by Sonic
+var langs = map[Lang]bool{
+	"afr": true, "aka": true, "amh": true, "ara": true, "azj": true, "bel": true,
+	"ben": true, "bho": true, "bul": true, "cat": true, "ceb": true, "ces": true,
+	"cmn": true, "dan": true, "deu": true, "ell": true, "eng": true, "epo": true,
+	"est": true, "fin": true, "fra": true, "guj": true, "hat": true, "hau": true,
+	"heb": true, "hin": true, "hrv": true, "hun": true, "ibo": true, "ilo": true,
+	"ind": true, "ita": true, "jav": true, "jpn": true, "kan": true, "kat": true,
+	"khm": true, "kin": true, "kor": true, "kur": true, "lat": true, "lav": true,
+	"lit": true, "mai": true, "mal": true, "mar": true, "mkd": true, "mlg": true,
+	"mya": true, "nep": true, "nld": true, "nno": true, "nob": true, "nya": true,
+	"ori": true, "orm": true, "pan": true, "pes": true, "pol": true, "por": true,
+	"ron": true, "run": true, "rus": true, "sin": true, "skr": true, "slk": true,
+	"slv": true, "sna": true, "som": true, "spa": true, "srp": true, "swe": true,
+	"tam": true, "tel": true, "tgl": true, "tha": true, "tir": true, "tuk": true,
+	"tur": true, "uig": true, "ukr": true, "urd": true, "uzb": true, "vie": true,
+	"ydd": true, "yor": true, "zul": true,
+}
+
+// Validate returns ErrInvalidLang if the language is not recognised by Sonic.
+// An empty language is valid and results in the language being detected.
+func (l Lang) Validate() error {
+	if l == "" || l == LangNone || langs[l] {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrInvalidLang, string(l))
+}
@@ -0,0 +1,54 @@
+package sonic_test
+
+import (
+	"testing"
+
+	"github.com/stevecallear/sonic"
+)
+
+func TestLang_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		lang sonic.Lang
+		err  error
+	}{
+		{
+			name: "should allow an empty lang",
+			lang: "",
+		},
+		{
+			name: "should allow none",
+			lang: sonic.LangNone,
+		},
+		{
+			name: "should allow defined langs",
+			lang: sonic.LangEnglish,
+		},
+		{
+			name: "should allow converted langs",
+			lang: sonic.Lang("ukr"),
+		},
+		{
+			name: "should return an error for two letter codes",
+			lang: "en",
+			err:  sonic.ErrInvalidLang,
+		},
+		{
+			name: "should return an error for unknown codes",
+			lang: "xyz",
+			err:  sonic.ErrInvalidLang,
+		},
+		{
+			name: "should return an error for upper case codes",
+			lang: "ENG",
+			err:  sonic.ErrInvalidLang,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.lang.Validate()
+			AssertError(t, err, tt.err)
+		})
+	}
+}
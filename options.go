@@ -0,0 +1,257 @@
+package sonic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option represents a functional client option
+type Option func(*Options)
+
+// ErrInvalidURL indicates that a Sonic URL could not be parsed
+var ErrInvalidURL = errors.New("invalid url")
+
+// ParseURL parses a Sonic URL in the form sonic://:password@host:port into
+// options. The port defaults to 1491 and the pool size and pool timeout can be
+// specified using the pool and timeout query parameters.
+func ParseURL(s string) (Options, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Options{}, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if u.Scheme != "sonic" {
+		return Options{}, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+
+	var o Options
+	if u.User != nil {
+		o.Password, _ = u.User.Password()
+	}
+	if o.Password == "" {
+		return Options{}, fmt.Errorf("%w: missing password", ErrInvalidURL)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return Options{}, fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+	if port == "" {
+		_, port, _ = net.SplitHostPort(DefaultAddr)
+	}
+	o.Addr = net.JoinHostPort(host, port)
+
+	for k, v := range u.Query() {
+		switch k {
+		case "pool":
+			n, err := strconv.Atoi(v[0])
+			if err != nil || n <= 0 {
+				return Options{}, fmt.Errorf("%w: invalid pool size %q", ErrInvalidURL, v[0])
+			}
+			o.PoolSize = n
+		case "timeout":
+			d, err := time.ParseDuration(v[0])
+			if err != nil || d <= 0 {
+				return Options{}, fmt.Errorf("%w: invalid timeout %q", ErrInvalidURL, v[0])
+			}
+			o.PoolTimeout = d
+		default:
+			return Options{}, fmt.Errorf("%w: unknown parameter %q", ErrInvalidURL, k)
+		}
+	}
+
+	return o, nil
+}
+
+// NewIngestWith returns a new ingest client for the specified address, password
+// and options
+func NewIngestWith(addr, password string, opts ...Option) *Ingest {
+	return NewIngest(newOptions(addr, password, opts))
+}
+
+// NewSearchWith returns a new search client for the specified address, password
+// and options
+func NewSearchWith(addr, password string, opts ...Option) *Search {
+	return NewSearch(newOptions(addr, password, opts))
+}
+
+// NewControlWith returns a new control client for the specified address,
+// password and options
+func NewControlWith(addr, password string, opts ...Option) *Control {
+	return NewControl(newOptions(addr, password, opts))
+}
+
+// WithPoolSize sets the maximum number of pooled connections
+func WithPoolSize(n int) Option {
+	return func(o *Options) {
+		o.PoolSize = n
+	}
+}
+
+// WithPoolMinIdle sets the number of idle connections opened by WarmUp
+func WithPoolMinIdle(n int) Option {
+	return func(o *Options) {
+		o.PoolMinIdle = n
+	}
+}
+
+// WithPoolTimeout sets the time to wait for an available pooled connection
+func WithPoolTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.PoolTimeout = d
+	}
+}
+
+// WithPoolMaxIdleTime sets the idle time after which pooled connections are
+// pinged before reuse
+func WithPoolMaxIdleTime(d time.Duration) Option {
+	return func(o *Options) {
+		o.PoolMaxIdleTime = d
+	}
+}
+
+// WithPoolMaxLifetime sets the lifetime after which pooled connections are
+// replaced before reuse
+func WithPoolMaxLifetime(d time.Duration) Option {
+	return func(o *Options) {
+		o.PoolMaxLifetime = d
+	}
+}
+
+// WithKeepAlivePing sets the interval at which idle pooled connections are
+// pinged in the background, removing any that fail
+func WithKeepAlivePing(d time.Duration) Option {
+	return func(o *Options) {
+		o.KeepAlivePingInterval = d
+	}
+}
+
+// WithPingTimeout sets the deadline for pings that validate pooled connections
+func WithPingTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.PingTimeout = d
+	}
+}
+
+// WithConnectTimeout sets the timeout for connecting and starting a channel
+func WithConnectTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.ConnectTimeout = d
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive period for connections
+func WithKeepAlive(d time.Duration) Option {
+	return func(o *Options) {
+		o.KeepAlive = d
+	}
+}
+
+// WithTimeouts sets the deadlines applied to each read and write
+func WithTimeouts(read, write time.Duration) Option {
+	return func(o *Options) {
+		o.ReadTimeout = read
+		o.WriteTimeout = write
+	}
+}
+
+// WithRetry sets the number of times that commands are retried on connection
+// errors, and the delay between retries
+func WithRetry(n int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.MaxRetries = n
+		o.RetryBackoff = backoff
+	}
+}
+
+// WithReconnectBackoff sets the initial and maximum delays applied to
+// connection attempts following connection failures
+func WithReconnectBackoff(initial, max time.Duration) Option {
+	return func(o *Options) {
+		o.ReconnectBackoff = initial
+		o.ReconnectMaxDelay = max
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive connection failures that
+// open the circuit, and the time before an open circuit allows a probe request
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *Options) {
+		o.CircuitThreshold = threshold
+		o.CircuitCooldown = cooldown
+	}
+}
+
+// WithLogFn sets the function used to log commands and responses
+func WithLogFn(fn func(string)) Option {
+	return func(o *Options) {
+		o.LogFn = fn
+	}
+}
+
+// WithLogger sets the function used to log structured command and response
+// entries
+func WithLogger(fn func(LogEntry)) Option {
+	return func(o *Options) {
+		o.Logger = fn
+	}
+}
+
+// WithSlog sets the handler that receives debug log records for each command
+// and response
+func WithSlog(h slog.Handler) Option {
+	return func(o *Options) {
+		o.SlogHandler = h
+	}
+}
+
+// WithTracerProvider sets the provider used to create a span for each command
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithOnCommand sets the function called with the duration and error of each
+// completed command
+func WithOnCommand(fn func(cmd string, d time.Duration, err error)) Option {
+	return func(o *Options) {
+		o.OnCommand = fn
+	}
+}
+
+// WithTLS sets the TLS configuration used to connect
+func WithTLS(c *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = c
+	}
+}
+
+// WithDialer sets the function used to connect
+func WithDialer(fn func(ctx context.Context, addr string) (net.Conn, error)) Option {
+	return func(o *Options) {
+		o.Dialer = fn
+	}
+}
+
+func newOptions(addr, password string, opts []Option) Options {
+	o := Options{
+		Addr:     addr,
+		Password: password,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,151 @@
+package sonic_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/pool"
+)
+
+func TestNewIngestWith(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []sonic.Option
+		stats pool.Stats
+		logs  []string
+	}{
+		{
+			name:  "should use defaults",
+			stats: pool.Stats{MaxSize: 1, CurSize: 1, Idle: 1},
+		},
+		{
+			name: "should apply options",
+			opts: []sonic.Option{
+				sonic.WithPoolSize(3),
+				sonic.WithPoolTimeout(time.Second),
+				sonic.WithConnectTimeout(time.Second),
+			},
+			stats: pool.Stats{MaxSize: 3, CurSize: 1, Idle: 1},
+		},
+		{
+			name:  "should apply the log func",
+			stats: pool.Stats{MaxSize: 1, CurSize: 1, Idle: 1},
+			logs: []string{
+				"START ingest <redacted>",
+				"CONNECTED <sonic-server v1.2.3>",
+				"STARTED search protocol(1) buffer(20000)",
+				"PING",
+				"PONG",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			server.ConfigureStart("ingest", 20000)
+			server.On("^PING$").Send("PONG")
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				var addr string
+				var logs []string
+
+				opts := append(tt.opts, sonic.WithDialer(func(_ context.Context, a string) (net.Conn, error) {
+					addr = a
+					return conn, nil
+				}))
+				if tt.logs != nil {
+					opts = append(opts, sonic.WithLogFn(func(s string) {
+						logs = append(logs, s)
+					}))
+				}
+
+				ingest := sonic.NewIngestWith("localhost:1491", "password", opts...)
+				defer ingest.Close()
+
+				AssertError(t, ingest.Ping(), nil)
+				AssertEqual(t, addr, "localhost:1491")
+				AssertDeepEqual(t, ingest.PoolStats(), tt.stats)
+				AssertDeepEqual(t, logs, tt.logs)
+			})
+		})
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		exp  sonic.Options
+		err  error
+	}{
+		{
+			name: "should return an error if the url is malformed",
+			url:  "sonic://:pass%zz@localhost",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if the scheme is invalid",
+			url:  "http://:password@localhost:1491",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if the password is missing",
+			url:  "sonic://localhost:1491",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if the host is missing",
+			url:  "sonic://:password@:1491",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if the pool size is invalid",
+			url:  "sonic://:password@localhost?pool=none",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if the timeout is invalid",
+			url:  "sonic://:password@localhost?timeout=10",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should return an error if a parameter is unknown",
+			url:  "sonic://:password@localhost?size=4",
+			err:  sonic.ErrInvalidURL,
+		},
+		{
+			name: "should use the default port",
+			url:  "sonic://:password@localhost",
+			exp: sonic.Options{
+				Addr:     "localhost:1491",
+				Password: "password",
+			},
+		},
+		{
+			name: "should parse the url",
+			url:  "sonic://:p%40ss@sonic.local:1492?pool=4&timeout=10s",
+			exp: sonic.Options{
+				Addr:        "sonic.local:1492",
+				Password:    "p@ss",
+				PoolSize:    4,
+				PoolTimeout: 10 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act, err := sonic.ParseURL(tt.url)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			AssertDeepEqual(t, act, tt.exp)
+		})
+	}
+}
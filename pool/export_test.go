@@ -0,0 +1,16 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// SetNow sets the pool clock
+func SetNow(p *Pool, fn func() time.Time) {
+	p.nowFn = fn
+}
+
+// SetSleep sets the pool sleep func
+func SetSleep(p *Pool, fn func(context.Context, time.Duration) error) {
+	p.sleepFn = fn
+}
@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -76,18 +77,46 @@ func (mr *MockChannelMockRecorder) Read() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockChannel)(nil).Read))
 }
 
+// SetDeadline mocks base method.
+func (m *MockChannel) SetDeadline(arg0 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDeadline", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDeadline indicates an expected call of SetDeadline.
+func (mr *MockChannelMockRecorder) SetDeadline(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadline", reflect.TypeOf((*MockChannel)(nil).SetDeadline), arg0)
+}
+
 // Split mocks base method.
-func (m *MockChannel) Split(arg0 string) []string {
+func (m *MockChannel) Split(s string, overhead int) []string {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Split", arg0)
+	ret := m.ctrl.Call(m, "Split", s, overhead)
 	ret0, _ := ret[0].([]string)
 	return ret0
 }
 
 // Split indicates an expected call of Split.
-func (mr *MockChannelMockRecorder) Split(arg0 interface{}) *gomock.Call {
+func (mr *MockChannelMockRecorder) Split(s, overhead interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Split", reflect.TypeOf((*MockChannel)(nil).Split), s, overhead)
+}
+
+// SplitFunc mocks base method.
+func (m *MockChannel) SplitFunc(s string, overhead int, fn func(string) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SplitFunc", s, overhead, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SplitFunc indicates an expected call of SplitFunc.
+func (mr *MockChannelMockRecorder) SplitFunc(s, overhead, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Split", reflect.TypeOf((*MockChannel)(nil).Split), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitFunc", reflect.TypeOf((*MockChannel)(nil).SplitFunc), s, overhead, fn)
 }
 
 // Write mocks base method.
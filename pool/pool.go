@@ -1,8 +1,12 @@
 package pool
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"sync"
 	"time"
 )
@@ -10,143 +14,1085 @@ import (
 type (
 	// Pool represents a pool
 	Pool struct {
-		newFn   func() (Channel, error)
-		items   chan Channel
-		curSize int
-		maxSize int
-		timeout time.Duration
-		mu      *sync.Mutex
+		newFn       func(context.Context) (Channel, error)
+		validateFn  func(context.Context, Channel) bool
+		idle        []*item
+		avail       chan struct{}
+		resized     chan struct{}
+		lifo        bool
+		acquireMode AcquireMode
+		curSize     int
+		maxSize     int
+		minIdle     int
+		timeout     time.Duration
+		maxIdleTime time.Duration
+		idleTimeout time.Duration
+		maxLifetime time.Duration
+		maxRetries  int
+		backoff     time.Duration
+		newBackoff  time.Duration
+		newMaxDelay time.Duration
+		newFailures int
+		newAt       time.Time
+		threshold   int
+		cooldown    time.Duration
+		failures    int
+		openedAt    time.Time
+		probing     bool
+		closed      bool
+		draining    bool
+		drained     chan struct{}
+		done        chan struct{}
+		onAcquire   func(Channel)
+		onRelease   func(Channel, error)
+		onNew       func(Channel)
+		onRemove    func(Channel)
+		onReconnect func(failures int)
+		nowFn       func() time.Time
+		sleepFn     func(context.Context, time.Duration) error
+		mu          *sync.Mutex
 	}
 
 	// Options represents a set of pool options
 	Options struct {
-		NewFn   func() (Channel, error)
-		Size    int
-		Timeout time.Duration
+		NewFn           func() (Channel, error)
+		NewContextFn    func(context.Context) (Channel, error) // optional, takes precedence over NewFn
+		Size            int
+		MinIdle         int // optional
+		Timeout         time.Duration
+		MaxIdleTime     time.Duration                       // optional
+		IdleTimeout     time.Duration                       // optional, idle channels are replaced without validation
+		MaxLifetime     time.Duration                       // optional
+		Validate        func(Channel) bool                  // optional
+		ValidateContext func(context.Context, Channel) bool // optional, takes precedence over Validate
+		MaxRetries      int                                 // optional, retries on connection errors
+		Backoff         time.Duration                       // optional, delay between retries
+		NewBackoff      time.Duration                       // optional, initial delay after a channel creation failure
+		NewMaxDelay     time.Duration                       // optional, defaults to 30 seconds
+		Threshold       int                                 // optional, consecutive connection failures that open the circuit
+		Cooldown        time.Duration                       // optional, defaults to 30 seconds
+		PingInterval    time.Duration                       // optional, interval at which idle channels are validated
+		OnAcquire       func(Channel)                       // optional, called when a channel is acquired
+		OnRelease       func(Channel, error)                // optional, called when a channel is released
+		OnNew           func(Channel)                       // optional, called when a channel is created
+		OnRemove        func(Channel)                       // optional, called when a channel is closed and removed
+		OnReconnect     func(failures int)                  // optional, called when a channel is created following failures
+		LIFO            bool                                // optional, reuses the most recently released channel first
+		AcquireMode     AcquireMode                         // optional, defaults to AcquireBlock
+	}
+
+	// AcquireMode represents the behaviour when no channel is available
+	AcquireMode int
+
+	// Stats represents a set of pool statistics
+	Stats struct {
+		MaxSize int
+		CurSize int
+		Idle    int
+		InUse   int
 	}
 
 	// Channel represents a sonic channel
 	Channel interface {
 		Write(string) error
 		Read() (string, error)
-		Split(string) []string
+		Split(s string, overhead int) []string
+		SplitFunc(s string, overhead int, fn func(chunk string) error) error
 		Escape(string) string
+		SetDeadline(time.Time) error
 		Close() error
 	}
+
+	item struct {
+		channel   Channel
+		createdAt time.Time
+		usedAt    time.Time
+	}
+
+	discardError struct {
+		err error
+	}
+
+	noRetryError struct {
+		err error
+	}
+
+	timeoutKey struct{}
+)
+
+const (
+	// AcquireBlock waits for a channel to become available until the context
+	// is done or the timeout elapses
+	AcquireBlock AcquireMode = iota
+
+	// AcquireFail returns ErrExhausted immediately if no channel is available
+	// and the pool is at the max size
+	AcquireFail
 )
 
-// ErrTimeout indicates that a timeout occurred waiting for an available item
-var ErrTimeout = errors.New("pool: timeout waiting for available item")
+var (
+	// ErrTimeout indicates that a timeout occurred waiting for an available item.
+	// Returned errors wrap ErrTimeout with the time waited.
+	ErrTimeout = errors.New("pool: timeout waiting for available item")
+
+	// ErrExhausted indicates that no item was available and the pool is at the
+	// max size, when using AcquireFail
+	ErrExhausted = errors.New("pool: exhausted")
+
+	// ErrClosed indicates that the pool has been closed, and is returned by any
+	// operation on a closed pool
+	ErrClosed = errors.New("pool: closed")
+
+	// ErrCircuitOpen indicates that requests are being rejected following
+	// consecutive connection failures
+	ErrCircuitOpen = errors.New("pool: circuit open")
+
+	// errKeepAlive indicates that an idle channel failed keep-alive validation
+	errKeepAlive = errors.New("pool: keep-alive validation failed")
+)
 
 // New returns a new pool for specified options
 func New(o Options) *Pool {
 	if o.Size <= 0 {
 		o.Size = 1
 	}
+	if o.MinIdle > o.Size {
+		o.MinIdle = o.Size
+	}
 	if o.Timeout <= 0 {
 		o.Timeout = 30 * time.Second
 	}
+	if o.NewMaxDelay <= 0 {
+		o.NewMaxDelay = 30 * time.Second
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = 30 * time.Second
+	}
+	if o.NewContextFn == nil {
+		o.NewContextFn = func(context.Context) (Channel, error) {
+			return o.NewFn()
+		}
+	}
+
+	if o.ValidateContext == nil && o.Validate != nil {
+		o.ValidateContext = func(_ context.Context, c Channel) bool {
+			return o.Validate(c)
+		}
+	}
+
+	p := &Pool{
+		newFn:       o.NewContextFn,
+		validateFn:  o.ValidateContext,
+		avail:       make(chan struct{}, o.Size),
+		resized:     make(chan struct{}),
+		lifo:        o.LIFO,
+		acquireMode: o.AcquireMode,
+		maxSize:     o.Size,
+		minIdle:     o.MinIdle,
+		timeout:     o.Timeout,
+		maxIdleTime: o.MaxIdleTime,
+		idleTimeout: o.IdleTimeout,
+		maxLifetime: o.MaxLifetime,
+		maxRetries:  o.MaxRetries,
+		backoff:     o.Backoff,
+		newBackoff:  o.NewBackoff,
+		newMaxDelay: o.NewMaxDelay,
+		threshold:   o.Threshold,
+		cooldown:    o.Cooldown,
+		onAcquire:   o.OnAcquire,
+		onRelease:   o.OnRelease,
+		onNew:       o.OnNew,
+		onRemove:    o.OnRemove,
+		onReconnect: o.OnReconnect,
+		nowFn:       time.Now,
+		sleepFn:     sleep,
+		done:        make(chan struct{}),
+		mu:          new(sync.Mutex),
+	}
+
+	if o.PingInterval > 0 && o.ValidateContext != nil {
+		go p.keepAlive(o.PingInterval)
+	}
+
+	return p
+}
+
+// WarmUp creates channels until the pool holds the minimum number of idle
+// channels, returning the first creation error
+func (p *Pool) WarmUp() error {
+	return p.WarmUpContext(context.Background())
+}
+
+// WarmUpContext creates channels until the pool holds the minimum number of
+// idle channels, returning the first creation error. Creation is bounded by
+// the context.
+func (p *Pool) WarmUpContext(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed || p.draining {
+			p.mu.Unlock()
+			return ErrClosed
+		}
+
+		n := len(p.idle)
+		p.mu.Unlock()
+
+		if n >= p.minIdle {
+			return nil
+		}
+
+		i, err := p.new(ctx)
+		if err != nil || i == nil {
+			return err
+		}
+
+		p.restore(i)
+	}
+}
+
+// WarmUpN attempts to create n channels, without exceeding the max size, and
+// returns the number created. Creation continues following errors, which are
+// joined and returned alongside the number created.
+func (p *Pool) WarmUpN(ctx context.Context, n int) (int, error) {
+	var created int
+	var errs []error
+	for a := 0; a < n; a++ {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		i, err := p.new(ctx)
+		if err != nil {
+			if errors.Is(err, ErrClosed) {
+				return created, err
+			}
+
+			errs = append(errs, err)
+			continue
+		}
+
+		if i == nil {
+			break
+		}
+
+		p.restore(i)
+		created++
+	}
 
-	return &Pool{
-		newFn:   o.NewFn,
-		items:   make(chan Channel, o.Size),
-		maxSize: o.Size,
-		timeout: o.Timeout,
-		mu:      new(sync.Mutex),
+	if err := errors.Join(errs...); err != nil {
+		return created, fmt.Errorf("pool: created %d of %d channels: %w", created, n, err)
 	}
+
+	return created, nil
+}
+
+// WithTimeout returns a copy of the context that overrides the pool timeout
+// when waiting for an available channel
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
 }
 
 // Exec executes against the next available channel
 func (p *Pool) Exec(fn func(Channel) error) error {
-	c, err := p.next()
-	if err != nil {
-		return err
+	return p.ExecContext(context.Background(), fn)
+}
+
+// ExecContext executes against the next available channel, waiting until the
+// context is done or the pool timeout, or any timeout set using WithTimeout,
+// elapses. If the channel connection fails then the func is retried on
+// another channel up to the max retries, unless the error is wrapped using
+// NoRetry.
+func (p *Pool) ExecContext(ctx context.Context, fn func(Channel) error) error {
+	for n := 0; ; n++ {
+		if err := p.allow(); err != nil {
+			return err
+		}
+
+		i, err := p.next(ctx)
+		if err != nil {
+			p.report(ctx, err, isNewErr(err))
+			return err
+		}
+
+		err = fn(i.channel)
+		p.release(i, err)
+		// the connection deadline is forced when the context is done, so the
+		// resulting connection errors are not failures
+		p.report(ctx, err, IsConnErr(err) && !isDone(ctx))
+
+		if n >= p.maxRetries || !isRetryable(err) || isDone(ctx) {
+			return err
+		}
+
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
 	}
+}
 
-	err = fn(c)
-	if err == io.EOF {
-		p.remove(c)
+// Query queries the next available channel
+func (p *Pool) Query(fn func(Channel) (interface{}, error)) (interface{}, error) {
+	return p.QueryContext(context.Background(), fn)
+}
+
+// QueryContext queries the next available channel, waiting until the context
+// is done or the pool timeout, or any timeout set using WithTimeout, elapses.
+// If the channel connection fails then the func is retried on another channel
+// up to the max retries.
+func (p *Pool) QueryContext(ctx context.Context, fn func(Channel) (interface{}, error)) (interface{}, error) {
+	var res interface{}
+	err := p.ExecContext(ctx, func(c Channel) error {
+		var err error
+		res, err = fn(c)
 		return err
+	})
+
+	return res, err
+}
+
+// ExecIdle executes against each idle channel, returning the number of
+// channels and the joined errors. Channels are released as if executed
+// individually, so broken channels are removed.
+func (p *Pool) ExecIdle(fn func(Channel) error) (int, error) {
+	if p.isDraining() {
+		return 0, ErrClosed
+	}
+
+	var items []*item
+	for done := false; !done; {
+		avail, _ := p.signals()
+		select {
+		case _, ok := <-avail:
+			i, err := p.pop(ok)
+			if err != nil {
+				// the pool has been closed, so the acquired channels are
+				// closed as they are released
+				for _, i := range items {
+					p.release(i, nil)
+				}
+				return 0, err
+			}
+			p.acquired(i)
+			items = append(items, i)
+		default:
+			done = true
+		}
 	}
 
-	p.restore(c)
-	return err
+	var errs []error
+	for n, i := range items {
+		err := fn(i.channel)
+		p.release(i, err)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %d: %w", n, err))
+		}
+	}
+
+	return len(items), errors.Join(errs...)
 }
 
-// Query queries the next available channel
-func (p *Pool) Query(fn func(Channel) (interface{}, error)) (interface{}, error) {
-	c, err := p.next()
-	if err != nil {
-		return nil, err
+// Resize sets the max size of the pool. If the size is increased then waiting
+// callers are able to create channels. If the size is decreased then idle
+// channels are closed, and in-use channels are closed as they are released,
+// until the pool is within the new size.
+func (p *Pool) Resize(n int) {
+	if n <= 0 {
+		n = 1
 	}
 
-	res, err := fn(c)
-	if err == io.EOF {
-		p.remove(c)
-		return res, err
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
 	}
 
-	p.restore(c)
-	return res, err
+	p.maxSize = n
+	if p.minIdle > n {
+		p.minIdle = n
+	}
+
+	if n > cap(p.avail) {
+		// move the idle signals that have not already been received
+		avail := make(chan struct{}, n)
+		for moved := false; !moved; {
+			select {
+			case <-p.avail:
+				avail <- struct{}{}
+			default:
+				moved = true
+			}
+		}
+		p.avail = avail
+	}
+
+	// close idle channels, with in-use channels closed as they are released
+	var removed []*item
+	for p.curSize > p.maxSize {
+		i := p.takeIdle()
+		if i == nil {
+			break
+		}
+
+		p.curSize--
+		removed = append(removed, i)
+	}
+
+	close(p.resized)
+	p.resized = make(chan struct{})
+	p.notifyDrained()
+	p.mu.Unlock()
+
+	for _, i := range removed {
+		i.channel.Close()
+		p.removed(i)
+	}
 }
 
-// Close closes all pool channels
-func (p *Pool) Close() error {
+// Stats returns the current pool statistics
+func (p *Pool) Stats() Stats {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	close(p.items)
-	for c := range p.items {
-		if err := c.Close(); err != nil {
-			return err
+	idle := len(p.idle)
+	return Stats{
+		MaxSize: p.maxSize,
+		CurSize: p.curSize,
+		Idle:    idle,
+		InUse:   p.curSize - idle,
+	}
+}
+
+// Close closes all pool channels. Subsequent calls return nil.
+func (p *Pool) Close() error {
+	return p.CloseContext(context.Background())
+}
+
+// CloseContext closes all pool channels, bounding each close by the context.
+// Once the context is done the channel deadline is set so that any pending
+// close operations fail, allowing the channel to release its connection.
+// Subsequent calls return nil.
+func (p *Pool) CloseContext(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	close(p.avail)
+	close(p.done)
+
+	var errs []error
+	removed := p.idle
+	p.idle = nil
+	for _, i := range removed {
+		if err := closeChannel(ctx, i.channel); err != nil {
+			errs = append(errs, err)
 		}
+		p.curSize--
+	}
+	p.mu.Unlock()
+
+	for _, i := range removed {
+		p.removed(i)
 	}
 
+	return errors.Join(errs...)
+}
+
+// Drain stops channels from being acquired and waits until all in-use channels
+// have been released, or the context is done, before closing the pool
+func (p *Pool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+
+	p.draining = true
+
+	var done chan struct{}
+	if p.curSize > len(p.idle) {
+		if p.drained == nil {
+			p.drained = make(chan struct{})
+		}
+		done = p.drained
+	}
+	p.mu.Unlock()
+
+	var err error
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	return errors.Join(err, p.Close())
+}
+
+// Discard wraps the error to indicate that the channel it was returned from must
+// not be reused, for example if the channel responses are no longer in sync
+func Discard(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &discardError{err: err}
+}
+
+func (e *discardError) Error() string {
+	return e.err.Error()
+}
+
+func (e *discardError) Unwrap() error {
+	return e.err
+}
+
+// NoRetry wraps the error to indicate that the func it was returned from must
+// not be retried, for example if it consumed input that cannot be replayed
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &noRetryError{err: err}
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noRetryError) Unwrap() error {
+	return e.err
+}
+
+// allow returns ErrCircuitOpen if the circuit is open. Once the cooldown has
+// elapsed a single probe request is allowed, which closes the circuit if it
+// succeeds.
+func (p *Pool) allow() error {
+	if p.threshold <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures < p.threshold {
+		return nil
+	}
+
+	if p.probing || p.nowFn().Sub(p.openedAt) < p.cooldown {
+		return ErrCircuitOpen
+	}
+
+	p.probing = true
 	return nil
 }
 
-func (p *Pool) new() error {
+// report records the request outcome against the circuit
+func (p *Pool) report(ctx context.Context, err error, failed bool) {
+	if p.threshold <= 0 {
+		return
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.curSize >= p.maxSize {
+	p.probing = false
+
+	if failed {
+		p.failures++
+		if p.failures >= p.threshold {
+			p.openedAt = p.nowFn()
+		}
+		return
+	}
+
+	// timeouts and cancellations neither open nor close the circuit
+	if err != nil && (isNeutral(err) || isDone(ctx)) {
+		return
+	}
+
+	p.failures = 0
+}
+
+// keepAlive validates the idle channels at each interval until the pool is
+// closed, removing any that fail. Channels are validated one at a time so
+// that the remaining idle channels stay available.
+func (p *Pool) keepAlive(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.mu.Lock()
+			items := append([]*item(nil), p.idle...)
+			p.mu.Unlock()
+
+			for _, i := range items {
+				if !p.takeItem(i) {
+					continue
+				}
+
+				p.acquired(i)
+
+				var err error
+				if !p.validateFn(context.Background(), i.channel) {
+					err = Discard(errKeepAlive)
+				}
+				p.release(i, err)
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// wait waits for the retry backoff or until the context is done
+func (p *Pool) wait(ctx context.Context) error {
+	if p.backoff <= 0 {
 		return nil
 	}
 
-	c, err := p.newFn()
-	if err != nil {
-		return err
+	return p.sleepFn(ctx, p.backoff)
+}
+
+func (p *Pool) new(ctx context.Context) (*item, error) {
+	p.mu.Lock()
+	if p.closed || p.draining {
+		p.mu.Unlock()
+		return nil, ErrClosed
 	}
 
-	p.items <- c
+	if p.curSize >= p.maxSize {
+		p.mu.Unlock()
+		return nil, nil
+	}
+
+	// reserve the slot before releasing the lock so that concurrent callers
+	// cannot exceed the max size while the channel is being created
 	p.curSize++
+	delay := p.newAt.Sub(p.nowFn())
+	p.mu.Unlock()
 
-	return nil
+	// back off following previous creation failures
+	if delay > 0 {
+		if err := p.sleepFn(ctx, delay); err != nil {
+			p.mu.Lock()
+			p.curSize--
+			p.notifyDrained()
+			p.mu.Unlock()
+
+			return nil, err
+		}
+	}
+
+	// creation is bounded by the context of the caller that requires the channel
+	c, err := p.newFn(ctx)
+
+	p.mu.Lock()
+	if err != nil {
+		p.curSize--
+		p.newFailed()
+		p.notifyDrained()
+		p.mu.Unlock()
+
+		return nil, err
+	}
+
+	failures := p.newFailures
+	p.newFailures = 0
+	p.newAt = time.Time{}
+
+	now := p.nowFn()
+	p.mu.Unlock()
+
+	if p.onNew != nil {
+		p.onNew(c)
+	}
+	if failures > 0 && p.onReconnect != nil {
+		p.onReconnect(failures)
+	}
+
+	return &item{channel: c, createdAt: now, usedAt: now}, nil
 }
 
-func (p *Pool) next() (Channel, error) {
-	if len(p.items) < 1 {
-		if err := p.new(); err != nil {
+// newFailed records the failure and delays the next channel creation by an
+// exponentially increasing, jittered duration. The caller must hold the lock.
+func (p *Pool) newFailed() {
+	p.newFailures++
+
+	if p.newBackoff <= 0 {
+		return
+	}
+
+	d := p.newBackoff
+	for n := 1; n < p.newFailures && d < p.newMaxDelay; n++ {
+		d *= 2
+	}
+	if d > p.newMaxDelay {
+		d = p.newMaxDelay
+	}
+
+	// spread concurrent reconnection attempts between half and all of the delay
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	p.newAt = p.nowFn().Add(d)
+}
+
+func (p *Pool) next(ctx context.Context) (*item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timeout := p.timeout
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok && d > 0 {
+		timeout = d
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		i, err := p.acquire(ctx, t.C)
+		if errors.Is(err, ErrTimeout) {
+			return nil, p.timeoutErr(timeout)
+		}
+		if err != nil {
 			return nil, err
 		}
+
+		// channels released while draining are not handed out again
+		if p.isDraining() {
+			p.restore(i)
+			return nil, ErrClosed
+		}
+
+		if p.valid(ctx, i) {
+			p.acquired(i)
+			return i, nil
+		}
+
+		p.remove(i)
 	}
+}
 
-	select {
-	case c := <-p.items:
-		return c, nil
-	case <-time.After(p.timeout):
-		return nil, ErrTimeout
+func (p *Pool) acquire(ctx context.Context, timeout <-chan time.Time) (*item, error) {
+	for {
+		avail, resized := p.signals()
+
+		select {
+		case _, ok := <-avail:
+			return p.pop(ok)
+		default:
+		}
+
+		i, err := p.new(ctx)
+		if err != nil || i != nil {
+			return i, err
+		}
+
+		if p.acquireMode == AcquireFail {
+			return nil, ErrExhausted
+		}
+
+		select {
+		case _, ok := <-avail:
+			return p.pop(ok)
+		case <-resized:
+			// the max size may have increased, allowing a new channel
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// timeoutErr wraps ErrTimeout with the time waited and the channels in use
+func (p *Pool) timeoutErr(d time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return fmt.Errorf("pool: timeout after %s (in use %d/%d): %w", d, p.curSize-len(p.idle), p.maxSize, ErrTimeout)
+}
+
+// signals returns the channels that signal an idle item being available and
+// the pool being resized
+func (p *Pool) signals() (chan struct{}, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.avail, p.resized
+}
+
+// valid returns false if the item has exceeded the max lifetime or the idle
+// timeout, or has been idle for longer than the max idle time and fails
+// validation within the context
+func (p *Pool) valid(ctx context.Context, i *item) bool {
+	now := p.nowFn()
+
+	if p.maxLifetime > 0 && now.Sub(i.createdAt) > p.maxLifetime {
+		return false
+	}
+
+	// the server may have closed the connection, so avoid a round trip
+	if p.idleTimeout > 0 && now.Sub(i.usedAt) > p.idleTimeout {
+		return false
+	}
+
+	if p.maxIdleTime <= 0 || p.validateFn == nil {
+		return true
+	}
+
+	if now.Sub(i.usedAt) <= p.maxIdleTime {
+		return true
+	}
+
+	return p.validateFn(ctx, i.channel)
+}
+
+func (p *Pool) release(i *item, err error) {
+	if p.onRelease != nil {
+		p.onRelease(i.channel, err)
+	}
+
+	if isBroken(err) {
+		p.remove(i)
+		return
+	}
+
+	p.restore(i)
+}
+
+func (p *Pool) restore(i *item) {
+	p.mu.Lock()
+
+	// the pool may have been closed, or shrunk, while the channel was in use
+	if p.closed || p.curSize > p.maxSize {
+		p.curSize--
+		p.notifyDrained()
+		p.mu.Unlock()
+
+		i.channel.Close()
+		p.removed(i)
+		return
+	}
+
+	i.usedAt = p.nowFn()
+	p.idle = append(p.idle, i)
+	p.avail <- struct{}{}
+	p.notifyDrained()
+	p.mu.Unlock()
+}
+
+// pop removes the next idle item once it has been signalled as available
+func (p *Pool) pop(ok bool) (*item, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the idle items are removed when the pool is closed
+	var i *item
+	if ok {
+		i = p.take()
+	}
+	if i == nil {
+		return nil, ErrClosed
 	}
+
+	return i, nil
 }
 
-func (p *Pool) restore(c Channel) {
-	p.items <- c
+// takeIdle removes the next idle item if one is available without waiting,
+// returning nil otherwise. The caller must hold the lock.
+func (p *Pool) takeIdle() *item {
+	select {
+	case <-p.avail:
+		return p.take()
+	default:
+		return nil
+	}
 }
 
-func (p *Pool) remove(c Channel) {
+// takeItem removes the specified item if it is still idle and no other caller
+// is waiting to take it, returning false otherwise
+func (p *Pool) takeItem(i *item) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	c.Close()
+	for n, ii := range p.idle {
+		if ii != i {
+			continue
+		}
+
+		select {
+		case <-p.avail:
+			p.idle = append(p.idle[:n], p.idle[n+1:]...)
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// take removes the least recently released idle item, or the most recently
+// released if the pool is LIFO, returning nil if there are no idle items. The
+// caller must hold the lock.
+func (p *Pool) take() *item {
+	n := len(p.idle)
+	if n == 0 {
+		return nil
+	}
+
+	var i *item
+	if p.lifo {
+		i, p.idle[n-1] = p.idle[n-1], nil
+		p.idle = p.idle[:n-1]
+	} else {
+		i, p.idle[0] = p.idle[0], nil
+		p.idle = p.idle[1:]
+	}
+
+	return i
+}
+
+// remove removes the item from the pool and closes the channel. The channel
+// is closed without holding the lock, as closing can wait on the server.
+func (p *Pool) remove(i *item) {
+	p.mu.Lock()
 	p.curSize--
+	p.notifyDrained()
+	p.mu.Unlock()
+
+	i.channel.Close()
+	p.removed(i)
+}
+
+// isDraining returns true if the pool is being drained
+func (p *Pool) isDraining() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.draining
+}
+
+// notifyDrained signals a pending drain once no channels are in use. The
+// caller must hold the lock.
+func (p *Pool) notifyDrained() {
+	if p.drained != nil && p.curSize == len(p.idle) {
+		close(p.drained)
+		p.drained = nil
+	}
+}
+
+// acquired calls the acquire callback for the item, if specified
+func (p *Pool) acquired(i *item) {
+	if p.onAcquire != nil {
+		p.onAcquire(i.channel)
+	}
+}
+
+// removed calls the remove callback for the item, if specified
+func (p *Pool) removed(i *item) {
+	if p.onRemove != nil {
+		p.onRemove(i.channel)
+	}
+}
+
+// closeChannel closes the channel, expiring the channel deadline if the context
+// is done before the close completes
+func closeChannel(ctx context.Context, c Channel) error {
+	if ctx.Done() == nil {
+		return c.Close()
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		c.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	return c.Close()
+}
+
+// sleep waits for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isBroken returns true if the error indicates that the channel can no longer
+// be used, as opposed to a recoverable protocol error
+func isBroken(err error) bool {
+	var de *discardError
+	if errors.As(err, &de) {
+		return true
+	}
+
+	return IsConnErr(err)
+}
+
+// IsConnErr returns true if the error indicates that the underlying connection
+// has failed, rather than the server rejecting a command
+func IsConnErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// isRetryable returns true if the func failed due to a connection error and
+// has not been marked as non-retryable
+func isRetryable(err error) bool {
+	var ne *noRetryError
+	return IsConnErr(err) && !errors.As(err, &ne)
+}
+
+// isNewErr returns true if an error returned when acquiring a channel was
+// caused by a channel creation failure
+func isNewErr(err error) bool {
+	return err != nil && !isNeutral(err)
+}
+
+// isNeutral returns true if the error was caused by the caller or the pool
+// rather than the connection
+func isNeutral(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrExhausted) ||
+		errors.Is(err, ErrClosed) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// isDone returns true if the context is done or its deadline has passed, as
+// connection deadlines derived from the context can elapse fractionally
+// before the context itself
+func isDone(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+
+	d, ok := ctx.Deadline()
+	return ok && !time.Now().Before(d)
 }
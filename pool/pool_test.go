@@ -3,17 +3,210 @@ package pool_test
 //go:generate mockgen -source=pool.go -destination=mocks/pool.go -package=mocks
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stevecallear/sonic/pool"
 	"github.com/stevecallear/sonic/pool/mocks"
 )
 
+func TestPool_WarmUp(t *testing.T) {
+	err := errors.New("error")
+
+	tests := []struct {
+		name    string
+		minIdle int
+		newErr  error
+		exp     pool.Stats
+		err     error
+	}{
+		{
+			name:    "should return create errors",
+			minIdle: 1,
+			newErr:  err,
+			exp:     pool.Stats{MaxSize: 3},
+			err:     err,
+		},
+		{
+			name:    "should create the min idle channels",
+			minIdle: 2,
+			exp:     pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2},
+		},
+		{
+			name:    "should not exceed the max size",
+			minIdle: 5,
+			exp:     pool.Stats{MaxSize: 3, CurSize: 3, Idle: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					if tt.newErr != nil {
+						return nil, tt.newErr
+					}
+					return mocks.NewMockChannel(ctrl), nil
+				},
+				Size:    3,
+				MinIdle: tt.minIdle,
+			})
+
+			err := p.WarmUp()
+			if err != tt.err {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			if act := p.Stats(); act != tt.exp {
+				t.Errorf("got %+v, expected %+v", act, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_WarmUpContext(t *testing.T) {
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			t.Error("expected no channels to be created")
+			return nil, nil
+		},
+		Size:    3,
+		MinIdle: 2,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.WarmUpContext(ctx); err != context.Canceled {
+		t.Errorf("got %v, expected %v", err, context.Canceled)
+	}
+
+	if act, exp := p.Stats(), (pool.Stats{MaxSize: 3}); act != exp {
+		t.Errorf("got %+v, expected %+v", act, exp)
+	}
+}
+
+func TestPool_WarmUpN(t *testing.T) {
+	err := errors.New("error")
+
+	tests := []struct {
+		name   string
+		n      int
+		failOn int
+		exp    int
+		stats  pool.Stats
+		err    error
+	}{
+		{
+			name:   "should return partial success",
+			n:      3,
+			failOn: 3,
+			exp:    2,
+			stats:  pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2},
+			err:    err,
+		},
+		{
+			name:   "should continue following errors",
+			n:      3,
+			failOn: 1,
+			exp:    2,
+			stats:  pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2},
+			err:    err,
+		},
+		{
+			name:  "should create the channels",
+			n:     2,
+			exp:   2,
+			stats: pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2},
+		},
+		{
+			name:  "should not exceed the max size",
+			n:     5,
+			exp:   3,
+			stats: pool.Stats{MaxSize: 3, CurSize: 3, Idle: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var calls int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					if calls++; calls == tt.failOn {
+						return nil, err
+					}
+					return mocks.NewMockChannel(ctrl), nil
+				},
+				Size: 3,
+			})
+
+			n, err := p.WarmUpN(context.Background(), tt.n)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			if n != tt.exp {
+				t.Errorf("got %d, expected %d", n, tt.exp)
+			}
+
+			if act := p.Stats(); act != tt.stats {
+				t.Errorf("got %+v, expected %+v", act, tt.stats)
+			}
+		})
+	}
+}
+
+func TestPool_NewContextFn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+
+	var act interface{}
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			t.Error("got NewFn call, expected NewContextFn")
+			return nil, nil
+		},
+		NewContextFn: func(ctx context.Context) (pool.Channel, error) {
+			act = ctx.Value(key{})
+			return mocks.NewMockChannel(ctrl), nil
+		},
+	})
+
+	err := p.ExecContext(ctx, func(pool.Channel) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	if act != "value" {
+		t.Errorf("got %v, expected the acquiring context", act)
+	}
+}
+
 func TestPool_Exec(t *testing.T) {
 	err := errors.New("error")
+	netErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	discardErr := pool.Discard(err)
 
 	tests := []struct {
 		name   string
@@ -46,6 +239,36 @@ func TestPool_Exec(t *testing.T) {
 			},
 			err: io.EOF,
 		},
+		{
+			name: "should remove channels with net errors",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			exec: func(pool.Channel) error {
+				return netErr
+			},
+			err: netErr,
+		},
+		{
+			name: "should remove closed channels",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			exec: func(pool.Channel) error {
+				return net.ErrClosed
+			},
+			err: net.ErrClosed,
+		},
+		{
+			name: "should remove discarded channels",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			exec: func(pool.Channel) error {
+				return discardErr
+			},
+			err: discardErr,
+		},
 		{
 			name: "should execute channel actions",
 			setup: func(r *mocks.MockChannelMockRecorder) {
@@ -84,6 +307,7 @@ func TestPool_Exec(t *testing.T) {
 
 func TestPool_Query(t *testing.T) {
 	err := errors.New("error")
+	netErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
 
 	tests := []struct {
 		name   string
@@ -117,6 +341,16 @@ func TestPool_Query(t *testing.T) {
 			},
 			err: io.EOF,
 		},
+		{
+			name: "should remove channels with net errors",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			query: func(pool.Channel) (interface{}, error) {
+				return nil, netErr
+			},
+			err: netErr,
+		},
 		{
 			name: "should execute query operations",
 			setup: func(r *mocks.MockChannelMockRecorder) {
@@ -156,25 +390,54 @@ func TestPool_Query(t *testing.T) {
 	}
 }
 
-func TestPool_Close(t *testing.T) {
-	err := errors.New("error")
-
+func TestPool_ExecContext(t *testing.T) {
 	tests := []struct {
-		name  string
-		setup func(*mocks.MockChannelMockRecorder)
-		err   error
+		name    string
+		timeout time.Duration
+		ctxFn   func() (context.Context, context.CancelFunc)
+		busy    bool
+		err     error
 	}{
 		{
-			name: "should return close errors",
-			setup: func(r *mocks.MockChannelMockRecorder) {
-				r.Close().Return(err).Times(1)
+			name: "should return an error if the context is cancelled",
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
 			},
-			err: err,
+			err: context.Canceled,
 		},
 		{
-			name: "should close all channels",
-			setup: func(r *mocks.MockChannelMockRecorder) {
-				r.Close().Return(nil).Times(1)
+			name: "should return an error if the context deadline is exceeded",
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			busy: true,
+			err:  context.DeadlineExceeded,
+		},
+		{
+			name:    "should return an error if the pool timeout elapses",
+			timeout: 10 * time.Millisecond,
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			busy: true,
+			err:  pool.ErrTimeout,
+		},
+		{
+			name:    "should return an error if the per-call timeout elapses",
+			timeout: time.Minute,
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				return pool.WithTimeout(ctx, 10*time.Millisecond), cancel
+			},
+			busy: true,
+			err:  pool.ErrTimeout,
+		},
+		{
+			name: "should execute against available channels",
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
 			},
 		},
 	}
@@ -186,21 +449,1625 @@ func TestPool_Close(t *testing.T) {
 
 			p := pool.New(pool.Options{
 				NewFn: func() (pool.Channel, error) {
-					c := mocks.NewMockChannel(ctrl)
-					tt.setup(c.EXPECT())
-					return c, nil
+					return mocks.NewMockChannel(ctrl), nil
 				},
+				Timeout: tt.timeout,
 			})
 
-			// force a channel to be created
-			p.Exec(func(pool.Channel) error {
+			if tt.busy {
+				acquired := make(chan struct{})
+				release := make(chan struct{})
+				defer close(release)
+
+				go p.Exec(func(pool.Channel) error {
+					close(acquired)
+					<-release
+					return nil
+				})
+
+				<-acquired
+			}
+
+			ctx, cancel := tt.ctxFn()
+			defer cancel()
+
+			err := p.ExecContext(ctx, func(pool.Channel) error {
 				return nil
 			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+		})
+	}
+}
 
-			err := p.Close()
-			if err != tt.err {
+func TestPool_AcquireMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode pool.AcquireMode
+		err  error
+	}{
+		{
+			name: "should wait for a channel when blocking",
+			mode: pool.AcquireBlock,
+			err:  pool.ErrTimeout,
+		},
+		{
+			name: "should return an error immediately when failing",
+			mode: pool.AcquireFail,
+			err:  pool.ErrExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			timeout := 50 * time.Millisecond
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					return mocks.NewMockChannel(ctrl), nil
+				},
+				Timeout:     timeout,
+				AcquireMode: tt.mode,
+			})
+
+			acquired := make(chan struct{})
+			release := make(chan struct{})
+			defer close(release)
+
+			go p.Exec(func(pool.Channel) error {
+				close(acquired)
+				<-release
+				return nil
+			})
+			<-acquired
+
+			start := time.Now()
+			err := p.Exec(func(pool.Channel) error {
+				return nil
+			})
+			d := time.Since(start)
+
+			if !errors.Is(err, tt.err) {
 				t.Errorf("got %v, expected %v", err, tt.err)
 			}
+
+			if block := d >= timeout; block != (tt.mode == pool.AcquireBlock) {
+				t.Errorf("got %v, expected blocking to be %v", d, tt.mode == pool.AcquireBlock)
+			}
+		})
+	}
+}
+
+func TestPool_Timeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			return mocks.NewMockChannel(ctrl), nil
+		},
+		Size:    2,
+		Timeout: 10 * time.Millisecond,
+	})
+
+	var wg sync.WaitGroup
+	acquired := make(chan struct{}, 2)
+	release := make(chan struct{})
+	for n := 0; n < 2; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Exec(func(pool.Channel) error {
+				acquired <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-acquired
+	<-acquired
+
+	err := p.Exec(func(pool.Channel) error {
+		return nil
+	})
+	close(release)
+	wg.Wait()
+
+	if !errors.Is(err, pool.ErrTimeout) {
+		t.Errorf("got %v, expected %v", err, pool.ErrTimeout)
+	}
+
+	exp := "pool: timeout after 10ms (in use 2/2): " + pool.ErrTimeout.Error()
+	if act := err.Error(); act != exp {
+		t.Errorf("got %q, expected %q", act, exp)
+	}
+}
+
+func TestPool_WithTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			return mocks.NewMockChannel(ctrl), nil
+		},
+		Timeout: 10 * time.Millisecond,
+	})
+
+	acquired := make(chan struct{})
+	go p.Exec(func(pool.Channel) error {
+		close(acquired)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	<-acquired
+
+	ctx := pool.WithTimeout(context.Background(), time.Second)
+
+	err := p.ExecContext(ctx, func(pool.Channel) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+}
+
+func TestPool_QueryContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			return mocks.NewMockChannel(ctrl), nil
+		},
+	})
+
+	acquired := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	go p.Exec(func(pool.Channel) error {
+		close(acquired)
+		<-release
+		return nil
+	})
+
+	<-acquired
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := p.QueryContext(ctx, func(pool.Channel) (interface{}, error) {
+		return nil, nil
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestPool_Concurrency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var cur, max int32
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			n := atomic.AddInt32(&cur, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).AnyTimes()
+			return c, nil
+		},
+		Size: 2,
+	})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.Exec(func(pool.Channel) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("got %v, expected nil", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if act := atomic.LoadInt32(&max); act > 2 {
+		t.Errorf("got %d, expected at most %d", act, 2)
+	}
+}
+
+func TestPool_Retry(t *testing.T) {
+	err := errors.New("error")
+
+	tests := []struct {
+		name    string
+		retries int
+		errs    []error
+		cancel  bool
+		calls   int
+		created int
+		err     error
+	}{
+		{
+			name:    "should not retry by default",
+			errs:    []error{io.EOF, nil},
+			calls:   1,
+			created: 1,
+			err:     io.EOF,
+		},
+		{
+			name:    "should retry connection errors on a new channel",
+			retries: 2,
+			errs:    []error{io.EOF, nil},
+			calls:   2,
+			created: 2,
+		},
+		{
+			name:    "should return the error once retries are exhausted",
+			retries: 1,
+			errs:    []error{io.EOF, io.EOF, nil},
+			calls:   2,
+			created: 2,
+			err:     io.EOF,
+		},
+		{
+			name:    "should not retry protocol errors",
+			retries: 2,
+			errs:    []error{err, nil},
+			calls:   1,
+			created: 1,
+			err:     err,
+		},
+		{
+			name:    "should not retry discarded channels",
+			retries: 2,
+			errs:    []error{pool.Discard(err), nil},
+			calls:   1,
+			created: 1,
+			err:     err,
+		},
+		{
+			name:    "should not retry if the context is done",
+			retries: 2,
+			errs:    []error{io.EOF, nil},
+			cancel:  true,
+			calls:   1,
+			created: 1,
+			err:     io.EOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var created int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					created++
+					c := mocks.NewMockChannel(ctrl)
+					c.EXPECT().Close().Return(nil).AnyTimes()
+					return c, nil
+				},
+				MaxRetries: tt.retries,
+				Backoff:    time.Millisecond,
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var calls int
+			err := p.ExecContext(ctx, func(pool.Channel) error {
+				if tt.cancel {
+					cancel()
+				}
+
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			if calls != tt.calls {
+				t.Errorf("got %d calls, expected %d", calls, tt.calls)
+			}
+
+			if created != tt.created {
+				t.Errorf("got %d channels, expected %d", created, tt.created)
+			}
+		})
+	}
+}
+
+func TestPool_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		idle     time.Duration
+		valid    bool
+		setup    func(*mocks.MockChannelMockRecorder)
+		validate int
+		exp      int
+	}{
+		{
+			name:  "should not validate channels within the max idle time",
+			idle:  time.Second,
+			setup: func(r *mocks.MockChannelMockRecorder) {},
+			exp:   1,
+		},
+		{
+			name:     "should reuse valid idle channels",
+			idle:     time.Minute,
+			valid:    true,
+			setup:    func(r *mocks.MockChannelMockRecorder) {},
+			validate: 1,
+			exp:      1,
+		},
+		{
+			name: "should replace invalid idle channels",
+			idle: time.Minute,
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			validate: 1,
+			exp:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var n, v int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					if n == 0 {
+						tt.setup(c.EXPECT())
+					}
+
+					n++
+					return c, nil
+				},
+				MaxIdleTime: 30 * time.Second,
+				Validate: func(pool.Channel) bool {
+					v++
+					return tt.valid
+				},
+			})
+
+			now := time.Now()
+			pool.SetNow(p, func() time.Time {
+				return now
+			})
+
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			now = now.Add(tt.idle)
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			if v != tt.validate {
+				t.Errorf("got %d validations, expected %d", v, tt.validate)
+			}
+
+			if n != tt.exp {
+				t.Errorf("got %d channels, expected %d", n, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_ValidateContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	type key struct{}
+
+	var act interface{}
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			return mocks.NewMockChannel(ctrl), nil
+		},
+		MaxIdleTime: 30 * time.Second,
+		ValidateContext: func(ctx context.Context, _ pool.Channel) bool {
+			act = ctx.Value(key{})
+			return true
+		},
+	})
+
+	now := time.Now()
+	pool.SetNow(p, func() time.Time {
+		return now
+	})
+
+	p.Exec(func(pool.Channel) error {
+		return nil
+	})
+
+	now = now.Add(time.Minute)
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	p.ExecContext(ctx, func(pool.Channel) error {
+		return nil
+	})
+
+	if act != "value" {
+		t.Errorf("got %v, expected the acquire context", act)
+	}
+}
+
+func TestPool_MaxLifetime(t *testing.T) {
+	tests := []struct {
+		name  string
+		age   time.Duration
+		setup func(*mocks.MockChannelMockRecorder)
+		exp   int
+	}{
+		{
+			name:  "should reuse channels within the max lifetime",
+			age:   time.Minute,
+			setup: func(r *mocks.MockChannelMockRecorder) {},
+			exp:   1,
+		},
+		{
+			name: "should replace channels older than the max lifetime",
+			age:  time.Hour,
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			exp: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var n int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					if n == 0 {
+						tt.setup(c.EXPECT())
+					}
+
+					n++
+					return c, nil
+				},
+				MaxLifetime: 30 * time.Minute,
+			})
+
+			now := time.Now()
+			pool.SetNow(p, func() time.Time {
+				return now
+			})
+
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			now = now.Add(tt.age)
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			if n != tt.exp {
+				t.Errorf("got %d channels, expected %d", n, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		idle  time.Duration
+		setup func(*mocks.MockChannelMockRecorder)
+		exp   int
+	}{
+		{
+			name:  "should reuse channels within the idle timeout",
+			idle:  time.Second,
+			setup: func(r *mocks.MockChannelMockRecorder) {},
+			exp:   1,
+		},
+		{
+			name: "should replace channels idle beyond the idle timeout",
+			idle: time.Minute,
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			exp: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var n, v int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					if n == 0 {
+						tt.setup(c.EXPECT())
+					}
+
+					n++
+					return c, nil
+				},
+				IdleTimeout: 30 * time.Second,
+				Validate: func(pool.Channel) bool {
+					v++
+					return true
+				},
+			})
+
+			now := time.Now()
+			pool.SetNow(p, func() time.Time {
+				return now
+			})
+
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			now = now.Add(tt.idle)
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			if v != 0 {
+				t.Errorf("got %d validations, expected 0", v)
+			}
+
+			if n != tt.exp {
+				t.Errorf("got %d channels, expected %d", n, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_LIFO(t *testing.T) {
+	tests := []struct {
+		name string
+		lifo bool
+		exp  []int
+	}{
+		{
+			name: "should reuse the least recently released channel",
+			exp:  []int{0, 1, 2, 0},
+		},
+		{
+			name: "should reuse the most recently released channel",
+			lifo: true,
+			exp:  []int{2, 2, 2, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var chs []pool.Channel
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					chs = append(chs, c)
+					return c, nil
+				},
+				Size: 3,
+				LIFO: tt.lifo,
+			})
+
+			// channels are released in the order that they are created
+			if _, err := p.WarmUpN(context.Background(), 3); err != nil {
+				t.Fatal(err)
+			}
+
+			var act []int
+			for range tt.exp {
+				p.Exec(func(c pool.Channel) error {
+					for n, ch := range chs {
+						if ch == c {
+							act = append(act, n)
+						}
+					}
+					return nil
+				})
+			}
+
+			if !reflect.DeepEqual(act, tt.exp) {
+				t.Errorf("got %v, expected %v", act, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_Resize(t *testing.T) {
+	t.Run("should allow waiting callers to create channels when grown", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		p := pool.New(pool.Options{
+			NewFn: func() (pool.Channel, error) {
+				return mocks.NewMockChannel(ctrl), nil
+			},
+			Size:    1,
+			Timeout: time.Second,
+		})
+
+		acquired := make(chan struct{})
+		release := make(chan struct{})
+		go p.Exec(func(pool.Channel) error {
+			close(acquired)
+			<-release
+			return nil
+		})
+		<-acquired
+
+		done := make(chan error)
+		go func() {
+			done <- p.Exec(func(pool.Channel) error {
+				return nil
+			})
+		}()
+
+		// allow the second caller to wait for the channel
+		time.Sleep(10 * time.Millisecond)
+		p.Resize(2)
+
+		if err := <-done; err != nil {
+			t.Errorf("got %v, expected nil", err)
+		}
+		close(release)
+
+		exp := pool.Stats{MaxSize: 2, CurSize: 2, Idle: 2}
+		for n := 0; p.Stats() != exp && n < 100; n++ {
+			time.Sleep(time.Millisecond)
+		}
+
+		if act := p.Stats(); act != exp {
+			t.Errorf("got %+v, expected %+v", act, exp)
+		}
+	})
+
+	t.Run("should close channels down to the new size when shrunk", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var closed int32
+		p := pool.New(pool.Options{
+			NewFn: func() (pool.Channel, error) {
+				c := mocks.NewMockChannel(ctrl)
+				c.EXPECT().Close().DoAndReturn(func() error {
+					atomic.AddInt32(&closed, 1)
+					return nil
+				}).AnyTimes()
+				return c, nil
+			},
+			Size: 3,
+		})
+
+		// hold two channels in use, leaving one idle
+		var wg sync.WaitGroup
+		acquired := make(chan struct{}, 2)
+		release := make(chan struct{})
+		for n := 0; n < 2; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.Exec(func(pool.Channel) error {
+					acquired <- struct{}{}
+					<-release
+					return nil
+				})
+			}()
+		}
+		<-acquired
+		<-acquired
+
+		if _, err := p.WarmUpN(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		p.Resize(1)
+
+		exp := pool.Stats{MaxSize: 1, CurSize: 2, InUse: 2}
+		if act := p.Stats(); act != exp {
+			t.Errorf("got %+v, expected %+v", act, exp)
+		}
+
+		close(release)
+		wg.Wait()
+
+		exp = pool.Stats{MaxSize: 1, CurSize: 1, Idle: 1}
+		if act := p.Stats(); act != exp {
+			t.Errorf("got %+v, expected %+v", act, exp)
+		}
+
+		if n := atomic.LoadInt32(&closed); n != 2 {
+			t.Errorf("got %d closed channels, expected 2", n)
+		}
+	})
+}
+
+func TestPool_Reuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*mocks.MockChannelMockRecorder)
+		err   error
+		exp   int
+	}{
+		{
+			name:  "should reuse channels after protocol errors",
+			setup: func(r *mocks.MockChannelMockRecorder) {},
+			err:   errors.New("error"),
+			exp:   1,
+		},
+		{
+			name: "should not reuse channels after net errors",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+			err: &net.OpError{Op: "write", Net: "tcp", Err: errors.New("broken pipe")},
+			exp: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var n int
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					if n == 0 {
+						tt.setup(c.EXPECT())
+					}
+
+					n++
+					return c, nil
+				},
+			})
+
+			p.Exec(func(pool.Channel) error {
+				return tt.err
+			})
+
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			if n != tt.exp {
+				t.Errorf("got %d, expected %d", n, tt.exp)
+			}
+		})
+	}
+}
+
+func TestPool_Stats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			return mocks.NewMockChannel(ctrl), nil
+		},
+		Size: 3,
+	})
+
+	assertStats := func(exp pool.Stats) {
+		t.Helper()
+		if act := p.Stats(); act != exp {
+			t.Errorf("got %+v, expected %+v", act, exp)
+		}
+	}
+
+	assertStats(pool.Stats{MaxSize: 3})
+
+	p.Exec(func(pool.Channel) error {
+		assertStats(pool.Stats{MaxSize: 3, CurSize: 1, InUse: 1})
+
+		return p.Exec(func(pool.Channel) error {
+			assertStats(pool.Stats{MaxSize: 3, CurSize: 2, InUse: 2})
+			return nil
+		})
+	})
+
+	assertStats(pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2})
+
+	p.Exec(func(pool.Channel) error {
+		assertStats(pool.Stats{MaxSize: 3, CurSize: 2, Idle: 1, InUse: 1})
+		return nil
+	})
+}
+
+func TestPool_Close(t *testing.T) {
+	err := errors.New("error")
+
+	tests := []struct {
+		name  string
+		setup func(*mocks.MockChannelMockRecorder)
+		err   error
+	}{
+		{
+			name: "should return close errors",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(err).Times(1)
+			},
+			err: err,
+		},
+		{
+			name: "should close all channels",
+			setup: func(r *mocks.MockChannelMockRecorder) {
+				r.Close().Return(nil).Times(1)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					tt.setup(c.EXPECT())
+					return c, nil
+				},
+			})
+
+			// force a channel to be created
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			err := p.Close()
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			// subsequent calls are a no-op
+			if err := p.Close(); err != nil {
+				t.Errorf("got %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestPool_Closed(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(*pool.Pool) error
+	}{
+		{
+			name: "should return an error from exec",
+			fn: func(p *pool.Pool) error {
+				return p.Exec(func(pool.Channel) error {
+					return nil
+				})
+			},
+		},
+		{
+			name: "should return an error from exec context",
+			fn: func(p *pool.Pool) error {
+				return p.ExecContext(context.Background(), func(pool.Channel) error {
+					return nil
+				})
+			},
+		},
+		{
+			name: "should return an error from query",
+			fn: func(p *pool.Pool) error {
+				_, err := p.Query(func(pool.Channel) (interface{}, error) {
+					return nil, nil
+				})
+				return err
+			},
+		},
+		{
+			name: "should return an error from exec idle",
+			fn: func(p *pool.Pool) error {
+				_, err := p.ExecIdle(func(pool.Channel) error {
+					return nil
+				})
+				return err
+			},
+		},
+		{
+			name: "should return an error from warm up",
+			fn: func(p *pool.Pool) error {
+				return p.WarmUp()
+			},
+		},
+		{
+			name: "should return an error from warm up n",
+			fn: func(p *pool.Pool) error {
+				_, err := p.WarmUpN(context.Background(), 1)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					c.EXPECT().Close().Return(nil).Times(1)
+					return c, nil
+				},
+				MinIdle: 1,
+			})
+
+			// force a channel to be created
+			p.Exec(func(pool.Channel) error {
+				return nil
+			})
+
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			p.Resize(2)
+
+			if err := tt.fn(p); !errors.Is(err, pool.ErrClosed) {
+				t.Errorf("got %v, expected %v", err, pool.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestPool_Close_All(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	err := errors.New("error")
+	errs := []error{nil, err, nil}
+
+	var n int
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(errs[n]).Times(1)
+
+			n++
+			return c, nil
+		},
+		Size: 3,
+	})
+
+	// force three channels to be created by holding each one
+	p.Exec(func(pool.Channel) error {
+		return p.Exec(func(pool.Channel) error {
+			return p.Exec(func(pool.Channel) error {
+				return nil
+			})
+		})
+	})
+
+	if n != 3 {
+		t.Fatalf("got %d, expected %d", n, 3)
+	}
+
+	act := p.Close()
+	if !errors.Is(act, err) {
+		t.Errorf("got %v, expected %v", act, err)
+	}
+}
+
+func TestPool_CloseContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			expired := make(chan struct{})
+
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().SetDeadline(gomock.Any()).DoAndReturn(func(time.Time) error {
+				close(expired)
+				return nil
+			}).Times(1)
+
+			// block the close until the deadline has been set
+			c.EXPECT().Close().DoAndReturn(func() error {
+				<-expired
+				return context.DeadlineExceeded
+			}).Times(1)
+
+			return c, nil
+		},
+	})
+
+	// force a channel to be created
+	p.Exec(func(pool.Channel) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := p.CloseContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	if err := p.CloseContext(ctx); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+}
+
+func TestPool_CloseInFlight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).Times(1)
+			return c, nil
+		},
+		Size: 4,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.Exec(func(pool.Channel) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			})
+			if err != nil && err != pool.ErrClosed {
+				t.Errorf("got %v, expected nil or %v", err, pool.ErrClosed)
+			}
+		}()
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	wg.Wait()
+}
+
+func TestPool_NewBackoff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	errNew := errors.New("error")
+	results := []error{errNew, errNew, errNew, nil, errNew, errNew}
+
+	var n int
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			err := results[n]
+			n++
+			if err != nil {
+				return nil, err
+			}
+
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).AnyTimes()
+			return c, nil
+		},
+		NewBackoff:  100 * time.Millisecond,
+		NewMaxDelay: 300 * time.Millisecond,
+	})
+
+	now := time.Now()
+	pool.SetNow(p, func() time.Time {
+		return now
+	})
+
+	var delays []time.Duration
+	pool.SetSleep(p, func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	})
+
+	for range results {
+		// remove the channel on success so that the next call creates another
+		p.Exec(func(pool.Channel) error {
+			return io.EOF
+		})
+	}
+
+	exp := []struct{ min, max time.Duration }{
+		{50 * time.Millisecond, 100 * time.Millisecond},  // first failure
+		{100 * time.Millisecond, 200 * time.Millisecond}, // second failure
+		{150 * time.Millisecond, 300 * time.Millisecond}, // third failure, capped
+		{50 * time.Millisecond, 100 * time.Millisecond},  // first failure after success
+	}
+
+	if len(delays) != len(exp) {
+		t.Fatalf("got %d delays, expected %d", len(delays), len(exp))
+	}
+
+	for i, d := range delays {
+		if d < exp[i].min || d > exp[i].max {
+			t.Errorf("got %v, expected between %v and %v", d, exp[i].min, exp[i].max)
+		}
+	}
+}
+
+func TestPool_CircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	errNew := errors.New("error")
+
+	var created int
+	var newErr error
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			created++
+			if newErr != nil {
+				return nil, newErr
+			}
+
+			return mocks.NewMockChannel(ctrl), nil
+		},
+		Threshold: 2,
+		Cooldown:  time.Minute,
+	})
+
+	now := time.Now()
+	pool.SetNow(p, func() time.Time {
+		return now
+	})
+
+	exec := func() error {
+		return p.Exec(func(pool.Channel) error {
+			return nil
+		})
+	}
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		newErr  error
+		err     error
+		created int
+	}{
+		{name: "first failure", newErr: errNew, err: errNew, created: 1},
+		{name: "second failure opens the circuit", newErr: errNew, err: errNew, created: 2},
+		{name: "open circuit fails fast", newErr: errNew, err: pool.ErrCircuitOpen, created: 2},
+		{name: "failed probe reopens the circuit", advance: time.Minute, newErr: errNew, err: errNew, created: 3},
+		{name: "reopened circuit fails fast", advance: 30 * time.Second, err: pool.ErrCircuitOpen, created: 3},
+		{name: "successful probe closes the circuit", advance: 30 * time.Second, created: 4},
+		{name: "closed circuit allows requests", created: 4},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		newErr = s.newErr
+
+		err := exec()
+		if err != s.err {
+			t.Errorf("%s: got %v, expected %v", s.name, err, s.err)
+		}
+
+		if created != s.created {
+			t.Errorf("%s: got %d channels, expected %d", s.name, created, s.created)
+		}
+	}
+}
+
+func TestPool_CircuitBreaker_Cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).AnyTimes()
+			return c, nil
+		},
+		Threshold: 1,
+		Cooldown:  time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the forced connection deadline results in a connection error
+	err := p.ExecContext(ctx, func(pool.Channel) error {
+		cancel()
+		return &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}
+	})
+	if !pool.IsConnErr(err) {
+		t.Errorf("got %v, expected a connection error", err)
+	}
+
+	err = p.Exec(func(pool.Channel) error {
+		return nil
+	})
+	if err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+}
+
+func TestPool_ExecIdle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var created int
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			created++
+			c := mocks.NewMockChannel(ctrl)
+			if created == 2 {
+				c.EXPECT().Close().Return(nil).Times(1)
+				c.EXPECT().Read().Return("", io.EOF).Times(1)
+			} else {
+				c.EXPECT().Read().Return("PONG", nil).Times(1)
+			}
+			return c, nil
+		},
+		Size:    3,
+		MinIdle: 3,
+	})
+
+	if err := p.WarmUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := p.ExecIdle(func(c pool.Channel) error {
+		_, err := c.Read()
+		return err
+	})
+	if n != 3 {
+		t.Errorf("got %d channels, expected 3", n)
+	}
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+
+	if act, exp := p.Stats(), (pool.Stats{MaxSize: 3, CurSize: 2, Idle: 2}); act != exp {
+		t.Errorf("got %+v, expected %+v", act, exp)
+	}
+}
+
+func TestPool_ExecIdle_Closed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var p *pool.Pool
+	p = pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).Times(1)
+			return c, nil
+		},
+		Size:    2,
+		MinIdle: 2,
+		OnAcquire: func(pool.Channel) {
+			// close the pool once the first channel has been acquired
+			p.Close()
+		},
+	})
+
+	if err := p.WarmUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := p.ExecIdle(func(pool.Channel) error {
+		t.Error("expected the channels not to be executed")
+		return nil
+	})
+	if !errors.Is(err, pool.ErrClosed) {
+		t.Errorf("got %v, expected %v", err, pool.ErrClosed)
+	}
+
+	if act, exp := p.Stats(), (pool.Stats{MaxSize: 2}); act != exp {
+		t.Errorf("got %+v, expected %+v", act, exp)
+	}
+}
+
+func TestPool_Callbacks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newErr := errors.New("error")
+
+	var created int
+	counts := map[string]int{}
+	var failures int
+	var releaseErrs []error
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			created++
+			if created == 1 {
+				return nil, newErr
+			}
+
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).Times(1)
+			return c, nil
+		},
+		Size:      1,
+		OnAcquire: func(pool.Channel) { counts["acquire"]++ },
+		OnRelease: func(_ pool.Channel, err error) {
+			counts["release"]++
+			releaseErrs = append(releaseErrs, err)
+		},
+		OnNew:    func(pool.Channel) { counts["new"]++ },
+		OnRemove: func(pool.Channel) { counts["remove"]++ },
+		OnReconnect: func(n int) {
+			counts["reconnect"]++
+			failures = n
+		},
+	})
+
+	if err := p.Exec(func(pool.Channel) error { return nil }); err != newErr {
+		t.Errorf("got %v, expected %v", err, newErr)
+	}
+
+	if err := p.Exec(func(pool.Channel) error { return nil }); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	if err := p.Exec(func(pool.Channel) error { return io.EOF }); err != io.EOF {
+		t.Errorf("got %v, expected %v", err, io.EOF)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	exp := map[string]int{"acquire": 2, "release": 2, "new": 1, "remove": 1, "reconnect": 1}
+	for k, v := range exp {
+		if counts[k] != v {
+			t.Errorf("got %d %s calls, expected %d", counts[k], k, v)
+		}
+	}
+
+	if failures != 1 {
+		t.Errorf("got %d failures, expected 1", failures)
+	}
+
+	if len(releaseErrs) != 2 || releaseErrs[0] != nil || releaseErrs[1] != io.EOF {
+		t.Errorf("got %v, expected [<nil> EOF]", releaseErrs)
+	}
+}
+
+func TestPool_Drain(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		err     error
+	}{
+		{
+			name:    "should wait for in-use channels",
+			timeout: time.Second,
+		},
+		{
+			name:    "should close if the context is done",
+			timeout: 5 * time.Millisecond,
+			err:     context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := pool.New(pool.Options{
+				NewFn: func() (pool.Channel, error) {
+					c := mocks.NewMockChannel(ctrl)
+					c.EXPECT().Close().Return(nil).Times(1)
+					return c, nil
+				},
+				Size: 2,
+			})
+
+			var done int32
+			acquired := make(chan struct{})
+			released := make(chan struct{})
+			go func() {
+				defer close(released)
+				p.Exec(func(pool.Channel) error {
+					close(acquired)
+					time.Sleep(50 * time.Millisecond)
+					atomic.StoreInt32(&done, 1)
+					return nil
+				})
+			}()
+			<-acquired
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			drained := make(chan error)
+			go func() {
+				drained <- p.Drain(ctx)
+			}()
+
+			// wait for the drain to start
+			for !errors.Is(p.Exec(func(pool.Channel) error { return nil }), pool.ErrClosed) {
+				time.Sleep(time.Millisecond)
+			}
+
+			err := <-drained
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, expected %v", err, tt.err)
+			}
+
+			if act, exp := atomic.LoadInt32(&done) == 1, tt.err == nil; act != exp {
+				t.Errorf("got completed %v, expected %v", act, exp)
+			}
+
+			<-released
+			if act, exp := p.Stats(), (pool.Stats{MaxSize: 2}); act != exp {
+				t.Errorf("got %+v, expected %+v", act, exp)
+			}
+		})
+	}
+}
+
+func TestPool_PingInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var created int32
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			if atomic.AddInt32(&created, 1) == 1 {
+				// the first channel fails validation
+				c.EXPECT().Read().Return("", io.EOF).MinTimes(1)
+			} else {
+				c.EXPECT().Read().Return("PONG", nil).AnyTimes()
+			}
+			c.EXPECT().Close().Return(nil).Times(1)
+			return c, nil
+		},
+		Size:    2,
+		MinIdle: 2,
+		Validate: func(c pool.Channel) bool {
+			_, err := c.Read()
+			return err == nil
+		},
+		PingInterval: 5 * time.Millisecond,
+	})
+
+	if err := p.WarmUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := pool.Stats{MaxSize: 2, CurSize: 1, Idle: 1}
+	for end := time.Now().Add(time.Second); p.Stats() != exp; {
+		if time.Now().After(end) {
+			t.Fatalf("got %+v, expected %+v", p.Stats(), exp)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+}
+
+func TestPool_PingInterval_Available(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	validating := make(chan struct{})
+	unblock := make(chan struct{})
+	var once sync.Once
+
+	p := pool.New(pool.Options{
+		NewFn: func() (pool.Channel, error) {
+			c := mocks.NewMockChannel(ctrl)
+			c.EXPECT().Close().Return(nil).Times(1)
+			return c, nil
+		},
+		Size:    2,
+		MinIdle: 2,
+		Validate: func(c pool.Channel) bool {
+			// block the first validation until the other channel is used
+			once.Do(func() {
+				close(validating)
+				<-unblock
+			})
+			return true
+		},
+		PingInterval: 5 * time.Millisecond,
+		Timeout:      time.Second,
+	})
+
+	if err := p.WarmUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	<-validating
+
+	err := p.Exec(func(pool.Channel) error { return nil })
+	close(unblock)
+	if err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+
+	// wait for the validated channel to be released
+	if err := p.Drain(context.Background()); err != nil {
+		t.Errorf("got %v, expected nil", err)
+	}
+}
+
+func TestIsConnErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		exp  bool
+	}{
+		{
+			name: "should return false for nil errors",
+			err:  nil,
+			exp:  false,
+		},
+		{
+			name: "should return true for eof errors",
+			err:  fmt.Errorf("read: %w", io.EOF),
+			exp:  true,
+		},
+		{
+			name: "should return true for net errors",
+			err:  &net.OpError{Op: "dial", Err: errors.New("refused")},
+			exp:  true,
+		},
+		{
+			name: "should return false for other errors",
+			err:  errors.New("error"),
+			exp:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if act := pool.IsConnErr(tt.err); act != tt.exp {
+				t.Errorf("got %v, expected %v", act, tt.exp)
+			}
 		})
 	}
 }
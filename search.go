@@ -1,8 +1,11 @@
 package sonic
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/stevecallear/sonic/pool"
 )
@@ -18,9 +21,16 @@ type (
 		Collection string
 		Bucket     string
 		Terms      string
-		Limit      int    // optional
-		Offset     int    // optional
-		Lang       string // optional
+		Limit      int  // optional
+		Offset     int  // optional
+		Lang       Lang // optional
+	}
+
+	// QueryResult represents a page of query results
+	QueryResult struct {
+		Objects []string
+		Count   int  // the number of objects in the page
+		HasMore bool // true if the page was full, so more objects may exist
 	}
 
 	// SuggestRequest represents a suggest request
@@ -32,6 +42,13 @@ type (
 	}
 )
 
+// DefaultQueryLimit is the default Sonic server query limit
+const DefaultQueryLimit = 10
+
+// ErrTextTooLong indicates that the query terms or suggest word would exceed
+// the server buffer
+var ErrTextTooLong = errors.New("text too long")
+
 // NewSearch returns a new search client
 func NewSearch(o Options) *Search {
 	return &Search{
@@ -41,75 +58,284 @@ func NewSearch(o Options) *Search {
 
 // Query returns a list of objects matching the specified query
 func (s *Search) Query(r QueryRequest) ([]string, error) {
-	res, err := s.pool.Query(func(c pool.Channel) (interface{}, error) {
-		msg := fmt.Sprintf("QUERY %s %s \"%s\"", r.Collection, r.Bucket, r.Terms)
-		msg = appendLang(appendOffset(appendLimit(msg, r.Limit), r.Offset), r.Lang)
+	return s.QueryContext(context.Background(), r)
+}
 
-		err := c.Write(msg)
-		if err != nil {
-			return nil, err
-		}
+// QueryContext returns a list of objects matching the specified query using the specified context
+func (s *Search) QueryContext(ctx context.Context, r QueryRequest) (objs []string, err error) {
+	ctx, op := s.start(ctx, "QUERY", r.Collection, r.Bucket)
+	defer func() { op.end(err, attrResults.Int(len(objs))) }()
 
-		// PENDING [marker]
-		_, err = c.Read()
-		if err != nil {
-			return nil, err
+	if err := validateRequired(r.Collection, r.Bucket); err != nil {
+		return nil, err
+	}
+
+	if err := r.Lang.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := s.pool.QueryContext(ctx, func(c pool.Channel) (interface{}, error) {
+		return withContext(ctx, c, func() (interface{}, error) {
+			msg := newCommand(len(r.Terms)+len(r.Lang)+64, "QUERY", r.Collection, r.Bucket).
+				text(r.Terms).
+				intParam("LIMIT", r.Limit).
+				intParam("OFFSET", r.Offset).
+				param("LANG", string(r.Lang)).
+				String()
+
+			if err := checkLen(c, msg); err != nil {
+				return nil, err
+			}
+
+			err := c.Write(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			return readEvent(c, "QUERY")
+		})
+	})
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	return parseEvent(res.(string)), nil
+}
+
+// QueryWithCount returns a page of objects matching the specified query, along
+// with the number of objects and whether the page was full. Pages are full if
+// they contain the request limit, or DefaultQueryLimit, of objects.
+func (s *Search) QueryWithCount(r QueryRequest) (QueryResult, error) {
+	objs, err := s.Query(r)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+
+	return QueryResult{
+		Objects: objs,
+		Count:   len(objs),
+		HasMore: len(objs) >= limit,
+	}, nil
+}
+
+// QueryBuckets queries each of the specified buckets concurrently, using the
+// request bucket as a template, and returns the objects for each bucket. The
+// number of concurrent queries is limited to the pool size. Failed buckets are
+// omitted from the results and their errors are joined.
+func (s *Search) QueryBuckets(ctx context.Context, r QueryRequest, buckets []string) (map[string][]string, error) {
+	res := make(map[string][]string, len(buckets))
+	errs := make([]error, len(buckets))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, s.pool.Stats().MaxSize)
+
+	for n, b := range buckets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[n] = fmt.Errorf("bucket %s: %w", b, ctx.Err())
+			continue
 		}
 
-		// EVENT QUERY [marker] [o1] [o2]
-		return c.Read()
+		wg.Add(1)
+		go func(n int, b string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			br := r
+			br.Bucket = b
+
+			objs, err := s.QueryContext(ctx, br)
+			if err != nil {
+				errs[n] = fmt.Errorf("bucket %s: %w", b, err)
+				return
+			}
+
+			mu.Lock()
+			res[b] = objs
+			mu.Unlock()
+		}(n, b)
+	}
+	wg.Wait()
+
+	return res, errors.Join(errs...)
+}
+
+// QueryAll returns all objects matching the specified query, requesting pages
+// of the request limit, or DefaultQueryLimit, until a partial page is returned.
+// Objects returned in more than one page are only included once.
+func (s *Search) QueryAll(r QueryRequest) ([]string, error) {
+	var objs []string
+	seen := map[string]bool{}
+
+	err := s.QueryStream(context.Background(), r, func(o string) error {
+		if !seen[o] {
+			seen[o] = true
+			objs = append(objs, o)
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return strings.Split(res.(string), " ")[3:], nil
+	return objs, nil
 }
 
-// Suggest returns a list of word suggestions based on the specified input
-func (s *Search) Suggest(r SuggestRequest) ([]string, error) {
-	res, err := s.pool.Query(func(c pool.Channel) (interface{}, error) {
-		msg := fmt.Sprintf("SUGGEST %s %s \"%s\"", r.Collection, r.Bucket, r.Word)
-		msg = appendLimit(msg, r.Limit)
+// QueryStream calls fn for each object matching the specified query, requesting
+// pages of the request limit, or DefaultQueryLimit, until a partial page is
+// returned. Iteration stops if fn returns an error or the context is done.
+func (s *Search) QueryStream(ctx context.Context, r QueryRequest, fn func(object string) error) error {
+	if r.Limit <= 0 {
+		r.Limit = DefaultQueryLimit
+	}
 
-		err := c.Write(msg)
+	for {
+		page, err := s.QueryContext(ctx, r)
 		if err != nil {
-			return "", err
+			return err
 		}
 
-		// PENDING [marker]
-		_, err = c.Read()
-		if err != nil {
-			return "", err
+		for _, o := range page {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < r.Limit {
+			return nil
 		}
 
-		// EVENT SUGGEST [marker] [t1] [t2] ...
-		return c.Read()
+		r.Offset += r.Limit
+	}
+}
+
+// Suggest returns a list of word suggestions based on the specified input
+func (s *Search) Suggest(r SuggestRequest) ([]string, error) {
+	return s.SuggestContext(context.Background(), r)
+}
+
+// SuggestContext returns a list of word suggestions based on the specified input using the specified context
+func (s *Search) SuggestContext(ctx context.Context, r SuggestRequest) (words []string, err error) {
+	ctx, op := s.start(ctx, "SUGGEST", r.Collection, r.Bucket)
+	defer func() { op.end(err, attrResults.Int(len(words))) }()
+
+	if err := validateRequired(r.Collection, r.Bucket); err != nil {
+		return nil, err
+	}
+
+	res, err := s.pool.QueryContext(ctx, func(c pool.Channel) (interface{}, error) {
+		return withContext(ctx, c, func() (interface{}, error) {
+			msg := newCommand(len(r.Word)+32, "SUGGEST", r.Collection, r.Bucket).
+				text(r.Word).
+				intParam("LIMIT", r.Limit).
+				String()
+
+			if err := checkLen(c, msg); err != nil {
+				return "", err
+			}
+
+			err := c.Write(msg)
+			if err != nil {
+				return "", err
+			}
+
+			return readEvent(c, "SUGGEST")
+		})
 	})
 	if err != nil {
-		return nil, err
+		return nil, contextErr(ctx, err)
+	}
+
+	return parseEvent(res.(string)), nil
+}
+
+// checkLen returns ErrTextTooLong if the command would exceed the maximum
+// number of bytes that can be sent on the channel
+func checkLen(c pool.Channel, msg string) error {
+	ch, ok := c.(*channel)
+	if !ok {
+		return nil
+	}
+
+	if n := len(msg) + len(ch.terminator); n > ch.maxBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrTextTooLong, n, ch.maxBytes)
+	}
+
+	return nil
+}
+
+// readEvent reads the PENDING response followed by the EVENT response with the
+// same marker, ignoring any unrelated responses. The channel is discarded if
+// an EVENT response is received for a different marker.
+func readEvent(c pool.Channel, kind string) (string, error) {
+	// PENDING [marker]
+	res, err := c.Read()
+	if err != nil {
+		return "", err
+	}
+
+	marker, ok := parsePending(res)
+	if !ok {
+		return "", pool.Discard(ErrInvalidResponse)
 	}
 
-	return strings.Split(res.(string), " ")[3:], nil
+	return awaitEvent(c, kind, marker)
 }
 
-func appendLimit(msg string, limit int) string {
-	if limit > 0 {
-		msg = fmt.Sprintf("%s LIMIT(%d)", msg, limit)
+// awaitEvent reads the EVENT response for the marker, ignoring any unrelated
+// responses. Any kind of event is accepted if kind is empty.
+func awaitEvent(c pool.Channel, kind, marker string) (string, error) {
+	for {
+		// EVENT [kind] [marker] [r1] [r2] ...
+		res, err := c.Read()
+		if err != nil {
+			return "", err
+		}
+
+		f := strings.Fields(res)
+		if len(f) < 3 || f[0] != "EVENT" {
+			continue
+		}
+
+		if (kind != "" && f[1] != kind) || f[2] != marker {
+			return "", pool.Discard(ErrInvalidResponse)
+		}
+
+		return res, nil
 	}
-	return msg
 }
 
-func appendOffset(msg string, offset int) string {
-	if offset > 0 {
-		msg = fmt.Sprintf("%s OFFSET(%d)", msg, offset)
+// parsePending returns the marker from a PENDING response
+func parsePending(res string) (string, bool) {
+	f := strings.Fields(res)
+	if len(f) != 2 || f[0] != "PENDING" {
+		return "", false
 	}
-	return msg
+
+	return f[1], true
 }
 
-func appendLang(msg, lang string) string {
-	if lang != "" {
-		msg = fmt.Sprintf("%s LANG(%s)", msg, lang)
+// parseEvent returns the results from an EVENT response, or nil if there are
+// no results
+func parseEvent(res string) []string {
+	// EVENT QUERY [marker] [o1] [o2]
+	f := strings.Fields(res)
+	if len(f) <= 3 {
+		return nil
 	}
-	return msg
+
+	return f[3:]
 }
@@ -1,11 +1,17 @@
 package sonic_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/pool"
+	"github.com/stevecallear/sonic/sonictest"
 )
 
 func TestNewSearch(t *testing.T) {
@@ -65,55 +71,771 @@ func TestSearch_Query(t *testing.T) {
 		{
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
 			connErr: ErrConnect,
 			err:     ErrConnect,
 		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.QueryRequest{
+				Collection: "my collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return an error if the collection is empty",
+			setup: func(*Server) {},
+			request: sonic.QueryRequest{
+				Bucket: "bucket",
+				Terms:  "term",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return an error if the lang is invalid",
+			setup: func(*Server) {},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Lang:       "xyz",
+			},
+			err: sonic.ErrInvalidLang,
+		},
 		{
 			name: "should return pending errors",
 			setup: func(s *Server) {
 				s.ConfigureStart("search", 20000)
-				s.On("^QUERY").Send("ERR PENDING")
+				s.On("^QUERY").Send("ERR PENDING")
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     errors.New("PENDING"),
+		},
+		{
+			name: "should return event errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^QUERY").Send("PENDING z98uDE0f").Send("ERR EVENT")
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     errors.New("EVENT"),
+		},
+		{
+			name: "should return query results",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+			exp: []string{"article:one", "article:two"},
+		},
+		{
+			name: "should return an error if the pending response is invalid",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^QUERY").Send("OK")
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return an error if the event marker does not match",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^QUERY").
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY a76SdE1g article:one article:two")
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should ignore unrelated responses",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
+					Send("PENDING z98uDE0f").
+					Send("PONG").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+			exp: []string{"article:one", "article:two"},
+		},
+		{
+			name: "should return nil if there are no results",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+		},
+		{
+			name: "should ignore empty results",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f  article:one  article:two ")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+			exp: []string{"article:one", "article:two"},
+		},
+		{
+			name: "should use optional parameters",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(5\) OFFSET\(10\) LANG\(eng\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      5,
+				Offset:     10,
+				Lang:       "eng",
+			},
+			exp: []string{"article:one", "article:two"},
+		},
+		{
+			name: "should disable language detection",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LANG\(none\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Lang:       sonic.LangNone,
+			},
+			exp: []string{"article:one", "article:two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				act, err := search.Query(tt.request)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestSearch_Query_Ended(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("search", 20000)
+	server.On(`^QUERY`).Send("PENDING z98uDE0f").Send("ENDED shutdown")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		search := sonic.NewSearch(sonic.Options{
+			Password: "password",
+		})
+		defer search.Close()
+
+		_, err := search.Query(sonic.QueryRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Terms:      "term",
+		})
+		AssertError(t, err, sonic.ErrConnectionEnded)
+		AssertDeepEqual(t, search.PoolStats(), pool.Stats{MaxSize: 1})
+	})
+}
+
+func TestSearch_Query_ReadBufferSize(t *testing.T) {
+	exp := make([]string, 2000)
+	for n := range exp {
+		exp[n] = fmt.Sprintf("article:%d", n)
+	}
+	event := "EVENT QUERY z98uDE0f " + strings.Join(exp, " ")
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{
+			name: "should read large events with the default buffer",
+		},
+		{
+			name: "should read large events with a larger buffer",
+			size: 64 * 1024,
+		},
+		{
+			name: "should read large events with a smaller buffer",
+			size: 64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			server.ConfigureStart("search", 20000)
+			server.On(`^QUERY`).Send("PENDING z98uDE0f").Send(event)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				search := sonic.NewSearch(sonic.Options{
+					Password:       "password",
+					Dialer:         sonictest.Dialer(conn),
+					ReadBufferSize: tt.size,
+				})
+				defer search.Close()
+
+				act, err := search.Query(sonic.QueryRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Terms:      "term",
+				})
+				AssertError(t, err, nil)
+				AssertDeepEqual(t, act, exp)
+			})
+		})
+	}
+}
+
+func TestSearch_QueryAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		connErr error
+		request sonic.QueryRequest
+		exp     []string
+		err     error
+	}{
+		{
+			name:    "should return connect errors",
+			setup:   func(*Server) {},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			connErr: ErrConnect,
+			err:     ErrConnect,
+		},
+		{
+			name: "should return page errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) OFFSET\(2\)$`).
+					Send("ERR QUERY")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      2,
+			},
+			err: errors.New("QUERY"),
+		},
+		{
+			name: "should return all pages",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) LANG\(eng\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) OFFSET\(2\) LANG\(eng\)$`).
+					Send("PENDING a76SdE1g").
+					Send("EVENT QUERY a76SdE1g article:two article:three")
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) OFFSET\(4\) LANG\(eng\)$`).
+					Send("PENDING k3d7sK1a").
+					Send("EVENT QUERY k3d7sK1a article:four")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      2,
+				Lang:       "eng",
+			},
+			exp: []string{"article:one", "article:two", "article:three", "article:four"},
+		},
+		{
+			name: "should use the default limit",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(10\) OFFSET\(5\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Offset:     5,
+			},
+			exp: []string{"article:one"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, tt.connErr
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				act, err := search.QueryAll(tt.request)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestSearch_QueryWithCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		request sonic.QueryRequest
+		exp     sonic.QueryResult
+		err     error
+	}{
+		{
+			name: "should return errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
+					Send("ERR QUERY")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      2,
+			},
+			err: errors.New("QUERY"),
+		},
+		{
+			name: "should return full pages",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      2,
+			},
+			exp: sonic.QueryResult{
+				Objects: []string{"article:one", "article:two"},
+				Count:   2,
+				HasMore: true,
+			},
+		},
+		{
+			name: "should return partial pages",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) OFFSET\(2\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:three")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+				Limit:      2,
+				Offset:     2,
+			},
+			exp: sonic.QueryResult{
+				Objects: []string{"article:three"},
+				Count:   1,
+			},
+		},
+		{
+			name: "should use the default limit",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			request: sonic.QueryRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Terms:      "term",
+			},
+			exp: sonic.QueryResult{
+				Objects: []string{"article:one", "article:two"},
+				Count:   2,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				act, err := search.QueryWithCount(tt.request)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestSearch_QueryBuckets(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		setup   func(*Server)
+		buckets []string
+		exp     map[string][]string
+		err     error
+	}{
+		{
+			name:    "should return context errors",
+			ctx:     cancelled,
+			setup:   func(*Server) {},
+			buckets: []string{"one", "two"},
+			exp:     map[string][]string{},
+			err:     errors.New("bucket one: context canceled\nbucket two: context canceled"),
+		},
+		{
+			name: "should join bucket errors",
+			ctx:  context.Background(),
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection one \"term\" LIMIT\(5\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one")
+				s.On(`^QUERY collection two \"term\" LIMIT\(5\)$`).
+					Send("ERR QUERY")
+			},
+			buckets: []string{"one", "two"},
+			exp: map[string][]string{
+				"one": {"article:one"},
+			},
+			err: errors.New("bucket two: QUERY"),
+		},
+		{
+			name: "should return the objects for each bucket",
+			ctx:  context.Background(),
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection one \"term\" LIMIT\(5\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+				s.On(`^QUERY collection two \"term\" LIMIT\(5\)$`).
+					Send("PENDING a76SdE1g").
+					Send("EVENT QUERY a76SdE1g article:three")
+			},
+			buckets: []string{"one", "two"},
+			exp: map[string][]string{
+				"one": {"article:one", "article:two"},
+				"two": {"article:three"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				act, err := search.QueryBuckets(tt.ctx, sonic.QueryRequest{
+					Collection: "collection",
+					Terms:      "term",
+					Limit:      5,
+				}, tt.buckets)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestSearch_TextTooLong(t *testing.T) {
+	long := strings.Repeat("a", 100)
+
+	tests := []struct {
+		name string
+		fn   func(*sonic.Search) error
+	}{
+		{
+			name: "should validate query terms",
+			fn: func(s *sonic.Search) error {
+				_, err := s.Query(sonic.QueryRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Terms:      long,
+				})
+				return err
 			},
-			err: errors.New("PENDING"),
 		},
 		{
-			name: "should return event errors",
+			name: "should validate suggest words",
+			fn: func(s *sonic.Search) error {
+				_, err := s.Suggest(sonic.SuggestRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Word:       long,
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			server.ConfigureStart("search", 200) // 200 * 0.5 = 100 bytes
+			server.On("^PING$").Send("PONG")
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				err := tt.fn(search)
+				if !errors.Is(err, sonic.ErrTextTooLong) {
+					t.Errorf("got %v, expected %v", err, sonic.ErrTextTooLong)
+				}
+				if err != nil && !strings.Contains(err.Error(), "limit of 100") {
+					t.Errorf("got %v, expected the limit", err)
+				}
+
+				// the command is not sent, so the connection remains usable
+				AssertError(t, search.Ping(), nil)
+			})
+		})
+	}
+}
+
+func TestSearch_QueryStream(t *testing.T) {
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name  string
+		setup func(*Server)
+		fn    func(cancel context.CancelFunc, o string) error
+		exp   []string
+		err   error
+	}{
+		{
+			name: "should return each object",
 			setup: func(s *Server) {
 				s.ConfigureStart("search", 20000)
-				s.On("^QUERY").Send("PENDING z98uDE0f").Send("ERR EVENT")
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\) OFFSET\(2\)$`).
+					Send("PENDING a76SdE1g").
+					Send("EVENT QUERY a76SdE1g article:three")
 			},
-			err: errors.New("EVENT"),
+			fn: func(context.CancelFunc, string) error {
+				return nil
+			},
+			exp: []string{"article:one", "article:two", "article:three"},
 		},
 		{
-			name: "should return query results",
+			name: "should stop if the func returns an error",
 			setup: func(s *Server) {
 				s.ConfigureStart("search", 20000)
-				s.On(`^QUERY collection bucket \"term\"$`).
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
 					Send("PENDING z98uDE0f").
 					Send("EVENT QUERY z98uDE0f article:one article:two")
 			},
-			request: sonic.QueryRequest{
-				Collection: "collection",
-				Bucket:     "bucket",
-				Terms:      "term",
+			fn: func(_ context.CancelFunc, o string) error {
+				if o == "article:one" {
+					return errStop
+				}
+				return nil
 			},
-			exp: []string{"article:one", "article:two"},
+			exp: []string{"article:one"},
+			err: errStop,
 		},
 		{
-			name: "should use optional parameters",
+			name: "should stop if the context is cancelled",
 			setup: func(s *Server) {
 				s.ConfigureStart("search", 20000)
-				s.On(`^QUERY collection bucket \"term\" LIMIT\(5\) OFFSET\(10\) LANG\(eng\)$`).
+				s.On(`^QUERY collection bucket \"term\" LIMIT\(2\)$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT QUERY z98uDE0f article:one article:two")
+			},
+			fn: func(cancel context.CancelFunc, _ string) error {
+				cancel()
+				return nil
+			},
+			exp: []string{"article:one"},
+			err: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				var act []string
+				err := search.QueryStream(ctx, sonic.QueryRequest{
+					Collection: "collection",
+					Bucket:     "bucket",
+					Terms:      "term",
+					Limit:      2,
+				}, func(o string) error {
+					act = append(act, o)
+					return tt.fn(cancel, o)
+				})
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+			})
+		})
+	}
+}
+
+func TestSearch_QueryContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		ctxFn   func() (context.Context, context.CancelFunc)
+		request sonic.QueryRequest
+		exp     []string
+		err     error
+	}{
+		{
+			name:  "should return an error if the context is cancelled",
+			setup: func(*Server) {},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     context.Canceled,
+		},
+		{
+			name: "should return an error if the deadline is exceeded",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^QUERY").Send("PENDING z98uDE0f")
+			},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			request: sonic.QueryRequest{Collection: "collection", Bucket: "bucket"},
+			err:     context.DeadlineExceeded,
+		},
+		{
+			name: "should return query results",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^QUERY collection bucket \"term\"$`).
 					Send("PENDING z98uDE0f").
 					Send("EVENT QUERY z98uDE0f article:one article:two")
 			},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
 			request: sonic.QueryRequest{
 				Collection: "collection",
 				Bucket:     "bucket",
 				Terms:      "term",
-				Limit:      5,
-				Offset:     10,
-				Lang:       "eng",
 			},
 			exp: []string{"article:one", "article:two"},
 		},
@@ -125,8 +847,14 @@ func TestSearch_Query(t *testing.T) {
 			tt.setup(server)
 
 			server.Run(t, func(t *testing.T, conn net.Conn) {
+				var dialled bool
 				restore := SetDialTCP(func(string) (net.Conn, error) {
-					return conn, tt.connErr
+					if dialled {
+						return nil, ErrConnect
+					}
+
+					dialled = true
+					return conn, nil
 				})
 				defer restore()
 
@@ -135,9 +863,18 @@ func TestSearch_Query(t *testing.T) {
 				})
 				defer search.Close()
 
-				act, err := search.Query(tt.request)
+				ctx, cancel := tt.ctxFn()
+				defer cancel()
+
+				act, err := search.QueryContext(ctx, tt.request)
 				AssertError(t, err, tt.err)
 				AssertDeepEqual(t, act, tt.exp)
+
+				if errors.Is(tt.err, context.DeadlineExceeded) {
+					// the channel should be discarded rather than reused
+					_, err = search.Query(tt.request)
+					AssertError(t, err, ErrConnect)
+				}
 			})
 		})
 	}
@@ -155,16 +892,37 @@ func TestSearch_Suggest(t *testing.T) {
 		{
 			name:    "should return connect errors",
 			setup:   func(*Server) {},
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
 			connErr: ErrConnect,
 			err:     ErrConnect,
 		},
+		{
+			name:  "should return an error if an identifier is invalid",
+			setup: func(*Server) {},
+			request: sonic.SuggestRequest{
+				Collection: "collection",
+				Bucket:     "bucket\r",
+				Word:       "wor",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
+		{
+			name:  "should return an error if the bucket is empty",
+			setup: func(*Server) {},
+			request: sonic.SuggestRequest{
+				Collection: "collection",
+				Word:       "wor",
+			},
+			err: sonic.ErrInvalidIdentifier,
+		},
 		{
 			name: "should return pending errors",
 			setup: func(s *Server) {
 				s.ConfigureStart("search", 20000)
 				s.On("^SUGGEST").Send("ERR PENDING")
 			},
-			err: errors.New("PENDING"),
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
+			err:     errors.New("PENDING"),
 		},
 		{
 			name: "should return event errors",
@@ -172,7 +930,8 @@ func TestSearch_Suggest(t *testing.T) {
 				s.ConfigureStart("search", 20000)
 				s.On("^SUGGEST").Send("PENDING z98uDE0f").Send("ERR EVENT")
 			},
-			err: errors.New("EVENT"),
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
+			err:     errors.New("EVENT"),
 		},
 		{
 			name: "should return suggestions",
@@ -189,6 +948,46 @@ func TestSearch_Suggest(t *testing.T) {
 			},
 			exp: []string{"word", "worry"},
 		},
+		{
+			name: "should return an error if the event marker does not match",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^SUGGEST").
+					Send("PENDING z98uDE0f").
+					Send("EVENT SUGGEST a76SdE1g word worry")
+			},
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
+			err:     sonic.ErrInvalidResponse,
+		},
+		{
+			name: "should return nil if there are no suggestions",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^SUGGEST collection bucket \"wor\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT SUGGEST z98uDE0f ")
+			},
+			request: sonic.SuggestRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Word:       "wor",
+			},
+		},
+		{
+			name: "should ignore empty suggestions",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^SUGGEST collection bucket \"wor\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT SUGGEST z98uDE0f word  worry")
+			},
+			request: sonic.SuggestRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Word:       "wor",
+			},
+			exp: []string{"word", "worry"},
+		},
 		{
 			name: "should use optional parameters",
 			setup: func(s *Server) {
@@ -231,6 +1030,97 @@ func TestSearch_Suggest(t *testing.T) {
 	}
 }
 
+func TestSearch_SuggestContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Server)
+		ctxFn   func() (context.Context, context.CancelFunc)
+		request sonic.SuggestRequest
+		exp     []string
+		err     error
+	}{
+		{
+			name:  "should return an error if the context is cancelled",
+			setup: func(*Server) {},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
+			err:     context.Canceled,
+		},
+		{
+			name: "should return an error if the deadline is exceeded",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^SUGGEST").Send("PENDING z98uDE0f")
+			},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			request: sonic.SuggestRequest{Collection: "collection", Bucket: "bucket"},
+			err:     context.DeadlineExceeded,
+		},
+		{
+			name: "should return suggestions",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On(`^SUGGEST collection bucket \"wor\"$`).
+					Send("PENDING z98uDE0f").
+					Send("EVENT SUGGEST z98uDE0f word world")
+			},
+			ctxFn: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			request: sonic.SuggestRequest{
+				Collection: "collection",
+				Bucket:     "bucket",
+				Word:       "wor",
+			},
+			exp: []string{"word", "world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				var dialled bool
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					if dialled {
+						return nil, ErrConnect
+					}
+
+					dialled = true
+					return conn, nil
+				})
+				defer restore()
+
+				search := sonic.NewSearch(sonic.Options{
+					Password: "password",
+				})
+				defer search.Close()
+
+				ctx, cancel := tt.ctxFn()
+				defer cancel()
+
+				act, err := search.SuggestContext(ctx, tt.request)
+				AssertError(t, err, tt.err)
+				AssertDeepEqual(t, act, tt.exp)
+
+				if errors.Is(tt.err, context.DeadlineExceeded) {
+					// the channel should be discarded rather than reused
+					_, err = search.Suggest(tt.request)
+					AssertError(t, err, ErrConnect)
+				}
+			})
+		})
+	}
+}
+
 func TestSearch_Ping(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -252,6 +1142,14 @@ func TestSearch_Ping(t *testing.T) {
 			},
 			exp: errors.New("PING"),
 		},
+		{
+			name: "should return an error if the response is not pong",
+			setup: func(s *Server) {
+				s.ConfigureStart("search", 20000)
+				s.On("^PING$").Send("STARTED search protocol(1) buffer(20000)")
+			},
+			exp: sonic.ErrInvalidResponse,
+		},
 		{
 			name: "should ping the server",
 			setup: func(s *Server) {
@@ -283,3 +1181,36 @@ func TestSearch_Ping(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkSearch_Query(b *testing.B) {
+	l := ServeLoopback(b, 20000)
+	defer l.Close()
+
+	search := sonic.NewSearch(sonic.Options{
+		Addr:     l.Addr().String(),
+		Password: "password",
+	})
+	defer search.Close()
+
+	r := sonic.QueryRequest{
+		Collection: "collection",
+		Bucket:     "bucket",
+		Terms:      "quick brown fox",
+		Limit:      10,
+		Offset:     20,
+		Lang:       "eng",
+	}
+
+	if err := search.Ping(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := search.Query(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,161 +2,181 @@ package sonic_test
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
-	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/sonictest"
 )
 
-type (
-	Server struct {
-		client    net.Conn
-		conn      net.Conn
-		reader    *bufio.Reader
-		responses []*Response
-	}
+type Server = sonictest.Server
 
-	Response struct {
-		regex   *regexp.Regexp
-		data    []string
-		matched bool
-	}
-)
+var (
+	ErrConnect = errors.New("CONNECT")
 
-var ErrConnect = errors.New("CONNECT")
+	NewServer    = sonictest.NewServer
+	NewTLSServer = sonictest.NewTLSServer
+)
 
-func NewServer() *Server {
-	c, s := net.Pipe()
+func SetDialTCP(fn func(string) (net.Conn, error)) func() {
+	pfn := sonic.DialTCPContext
+	sonic.DialTCPContext = func(_ context.Context, addr string) (net.Conn, error) {
+		return fn(addr)
+	}
 
-	return &Server{
-		client:    c,
-		conn:      s,
-		reader:    bufio.NewReader(s),
-		responses: []*Response{},
+	return func() {
+		sonic.DialTCPContext = pfn
 	}
 }
 
-func (s *Server) ConfigureStart(ctype string, maxBufferBytes int) *Server {
-	s.On(fmt.Sprintf("^START %s \\w+$", ctype)).
-		Send("CONNECTED <sonic-server v1.2.3>").
-		Send(fmt.Sprintf("STARTED search protocol(1) buffer(%d)", maxBufferBytes))
+func AssertError(t *testing.T, act, exp error) {
+	if act == exp || errors.Is(act, exp) {
+		return
+	}
 
-	return s
+	if act != nil && exp != nil {
+		if act.Error() == exp.Error() {
+			return
+		}
+	}
+
+	t.Errorf("got %v, expected %v", act, exp)
 }
 
-func (s *Server) On(pattern string) *Response {
-	r := &Response{
-		regex: regexp.MustCompile(pattern),
-		data:  []string{},
+func AssertEqual(t *testing.T, act, exp interface{}) {
+	if act != exp {
+		t.Errorf("got %d, expected %d", act, exp)
 	}
+}
 
-	s.responses = append(s.responses, r)
-	return r
+func AssertDeepEqual(t *testing.T, act, exp interface{}) {
+	if !reflect.DeepEqual(act, exp) {
+		t.Errorf("got %v, expected %v", act, exp)
+	}
 }
 
-func (s *Server) Run(t *testing.T, fn func(*testing.T, net.Conn)) {
+// SilentConn returns a connection that starts a channel and then never
+// responds, including to QUIT
+func SilentConn(ctype string) net.Conn {
+	client, server := net.Pipe()
 	go func() {
-		for {
-			str, err := s.reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					return
-				}
-				panic(err)
-			}
+		defer server.Close()
+		r := bufio.NewReader(server)
+		r.ReadString('\n') // START
+		fmt.Fprintf(server, "CONNECTED <sonic-server v1.2.3>\r\nSTARTED %s protocol(1) buffer(20000)\r\n", ctype)
+		io.Copy(io.Discard, r) // until the client closes
+	}()
+	return client
+}
 
-			str = strings.TrimSpace(str)
-			if strings.HasPrefix(str, "QUIT") {
-				s.conn.Write([]byte("ENDED quit\r\n"))
-				return
-			}
+// DropConn returns a connection that starts a channel with the specified
+// buffer size, acknowledges n commands and then closes on the next command
+func DropConn(ctype string, bufferSize, n int) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
 
-			var ok bool
-			var msgs []string
-			for _, r := range s.responses {
-				if msgs, ok = r.match(str); ok {
-					for _, msg := range msgs {
-						_, err = s.conn.Write([]byte(msg + "\r\n"))
-						if err != nil {
-							panic(err)
-						}
-					}
-					break
-				}
-			}
+		r := bufio.NewReader(server)
+		r.ReadString('\n') // START
+		fmt.Fprintf(server, "CONNECTED <sonic-server v1.2.3>\r\nSTARTED %s protocol(1) buffer(%d)\r\n", ctype, bufferSize)
 
-			if !ok {
-				_, err = s.conn.Write([]byte(fmt.Sprintf("ERR no match: %s \r\n", str)))
-				if err != nil {
-					panic(err)
-				}
-			}
+		// respond without blocking, as commands may be pipelined
+		for ; n > 0; n-- {
+			r.ReadString('\n')
+			go io.WriteString(server, "OK\r\n")
 		}
+		r.ReadString('\n')
 	}()
 
-	fn(t, s.client)
+	return client
+}
 
-	for _, r := range s.responses {
-		if !r.matched {
-			t.Errorf("not matched: %s", r.regex)
-		}
+// ServeLoopback accepts connections on a loopback listener with the specified
+// buffer size, acknowledging each command. Queries and suggestions return two
+// results.
+func ServeLoopback(tb testing.TB, bufferSize int) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
 	}
-}
 
-func (s *Server) Close() error {
-	return s.conn.Close()
-}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
 
-func (r *Response) Send(data string) *Response {
-	r.data = append(r.data, data)
-	return r
-}
+			go serveLoopback(conn, bufferSize)
+		}
+	}()
 
-func (r *Response) match(msg string) ([]string, bool) {
-	if r.regex.MatchString(msg) {
-		r.matched = true
-		return r.data, true
-	}
-	return nil, false
+	return l
 }
 
-func SetDialTCP(fn func(string) (net.Conn, error)) func() {
-	pfn := sonic.DialTCP
-	sonic.DialTCP = fn
+func serveLoopback(conn net.Conn, bufferSize int) {
+	defer conn.Close()
 
-	return func() {
-		sonic.DialTCP = pfn
-	}
-}
-
-func AssertError(t *testing.T, act, exp error) {
-	if act == exp {
-		return
-	}
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		// avoid allocating so that benchmarks reflect the client allocations
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return
+		}
 
-	if act != nil && exp != nil {
-		if act.Error() == exp.Error() {
+		switch {
+		case bytes.HasPrefix(line, []byte("START ")):
+			ctype, _, _ := strings.Cut(string(line[6:]), " ")
+			fmt.Fprintf(w, "CONNECTED <sonic-server v1.2.3>\r\nSTARTED %s protocol(1) buffer(%d)\r\n", ctype, bufferSize)
+		case bytes.HasPrefix(line, []byte("PING")):
+			w.WriteString("PONG\r\n")
+		case bytes.HasPrefix(line, []byte("QUERY ")):
+			w.WriteString("PENDING abc\r\nEVENT QUERY abc r1 r2\r\n")
+		case bytes.HasPrefix(line, []byte("SUGGEST ")):
+			w.WriteString("PENDING abc\r\nEVENT SUGGEST abc r1 r2\r\n")
+		case bytes.HasPrefix(line, []byte("QUIT")):
+			w.WriteString("ENDED quit\r\n")
+			w.Flush()
 			return
+		default:
+			w.WriteString("OK\r\n")
+		}
+
+		// respond once the buffered commands have been read
+		if r.Buffered() == 0 {
+			w.Flush()
 		}
 	}
+}
 
-	t.Errorf("got %v, expected %v", act, exp)
+type countingConn struct {
+	net.Conn
+	writes *int64
 }
 
-func AssertEqual(t *testing.T, act, exp interface{}) {
-	if act != exp {
-		t.Errorf("got %d, expected %d", act, exp)
-	}
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(c.writes, 1)
+	return c.Conn.Write(b)
 }
 
-func AssertDeepEqual(t *testing.T, act, exp interface{}) {
-	if !reflect.DeepEqual(act, exp) {
-		t.Errorf("got %v, expected %v", act, exp)
+// CountingDialer returns a TCP dialer that counts the connection writes
+func CountingDialer(writes *int64) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := sonic.DialTCPContext(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &countingConn{Conn: conn, writes: writes}, nil
 	}
 }
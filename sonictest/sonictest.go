@@ -0,0 +1,254 @@
+// Package sonictest provides a programmable fake Sonic server for testing code
+// that depends on the sonic clients.
+package sonictest
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type (
+	// Server represents a fake Sonic server that sends configured responses
+	// to matching commands
+	Server struct {
+		client    net.Conn
+		conn      net.Conn
+		reader    *bufio.Reader
+		responses []*Response
+	}
+
+	// Response represents the responses sent for a matching command
+	Response struct {
+		regex   *regexp.Regexp
+		data    []string
+		delay   time.Duration
+		matched atomic.Bool // set by the server goroutine
+	}
+)
+
+// NewServer returns a new server
+func NewServer() *Server {
+	c, s := net.Pipe()
+
+	return &Server{
+		client:    c,
+		conn:      s,
+		reader:    bufio.NewReader(s),
+		responses: []*Response{},
+	}
+}
+
+// NewTLSServer returns a server that negotiates TLS for the specified host,
+// along with a client config that trusts it
+func NewTLSServer(t testing.TB, host string) (*Server, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	s := NewServer()
+	s.conn = tls.Server(s.conn, &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	})
+	s.reader = bufio.NewReader(s.conn)
+
+	return s, &tls.Config{RootCAs: roots}
+}
+
+// Dialer returns a dialer that connects to the server, for use as the client
+// options dialer
+func (s *Server) Dialer() func(context.Context, string) (net.Conn, error) {
+	return Dialer(s.client)
+}
+
+// ConfigureStart configures the START handshake for the specified channel type
+// and buffer size
+func (s *Server) ConfigureStart(ctype string, maxBufferBytes int) *Server {
+	s.On(fmt.Sprintf("^START %s \\w+$", ctype)).
+		Send("CONNECTED <sonic-server v1.2.3>").
+		Send(fmt.Sprintf("STARTED search protocol(1) buffer(%d)", maxBufferBytes))
+
+	return s
+}
+
+// On returns a response for commands matching the specified pattern. Commands
+// are matched against responses in the order that they were configured.
+func (s *Server) On(pattern string) *Response {
+	r := &Response{
+		regex: regexp.MustCompile(pattern),
+		data:  []string{},
+	}
+
+	s.responses = append(s.responses, r)
+	return r
+}
+
+// Run serves commands while fn is executed with the client connection, failing
+// the test if any configured response was not matched. Unmatched commands
+// receive an ERR response.
+func (s *Server) Run(t *testing.T, fn func(*testing.T, net.Conn)) {
+	// buffer the responses, as a network connection would, so that the client
+	// can write multiple commands before reading
+	out := make(chan string, 1024)
+
+	// errors are reported once fn returns, as the test may have completed
+	// before the server goroutines observe them
+	errs := make(chan error, 2)
+	report := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	go func() {
+		for msg := range out {
+			_, err := s.conn.Write([]byte(msg + "\r\n"))
+			if err != nil {
+				// the client may close without reading all responses
+				if !isClosed(err) {
+					report(err)
+				}
+				for range out {
+				}
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for {
+			str, err := s.reader.ReadString('\n')
+			if err != nil {
+				// either side may close first
+				if !isClosed(err) {
+					report(err)
+				}
+				return
+			}
+
+			str = strings.TrimSpace(str)
+			if strings.HasPrefix(str, "QUIT") {
+				out <- "ENDED quit"
+				io.Copy(io.Discard, s.reader) // drain until the client closes
+				return
+			}
+
+			var ok bool
+			var msgs []string
+			for _, r := range s.responses {
+				if msgs, ok = r.match(str); ok {
+					time.Sleep(r.delay)
+					for _, msg := range msgs {
+						out <- msg
+					}
+					break
+				}
+			}
+
+			if !ok {
+				out <- fmt.Sprintf("ERR no match: %s ", str)
+			}
+		}
+	}()
+
+	fn(t, s.client)
+
+	select {
+	case err := <-errs:
+		t.Errorf("server error: %v", err)
+	default:
+	}
+
+	for _, r := range s.responses {
+		if !r.matched.Load() {
+			t.Errorf("not matched: %s", r.regex)
+		}
+	}
+}
+
+// Close closes the server connection. It can be called before the client
+// connection is closed, in which case the client receives read and write
+// errors.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// Send appends a response line to be sent when the command is matched
+func (r *Response) Send(data string) *Response {
+	r.data = append(r.data, data)
+	return r
+}
+
+// Delay delays the responses sent when the command is matched
+func (r *Response) Delay(d time.Duration) *Response {
+	r.delay = d
+	return r
+}
+
+func (r *Response) match(msg string) ([]string, bool) {
+	if r.regex.MatchString(msg) {
+		r.matched.Store(true)
+		return r.data, true
+	}
+	return nil, false
+}
+
+// Dialer returns a dialer that returns the specified connection, for use as
+// the client options dialer
+func Dialer(conn net.Conn) func(context.Context, string) (net.Conn, error) {
+	return func(context.Context, string) (net.Conn, error) {
+		return conn, nil
+	}
+}
@@ -0,0 +1,108 @@
+package sonictest_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stevecallear/sonic"
+	"github.com/stevecallear/sonic/sonictest"
+)
+
+func TestServer_Ingest(t *testing.T) {
+	server := sonictest.NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On(`^PUSH collection bucket object "text"$`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+			Dialer:   sonictest.Dialer(conn),
+		})
+		defer ingest.Close()
+
+		err := ingest.Push(sonic.PushRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Object:     "object",
+			Text:       "text",
+		})
+		if err != nil {
+			t.Errorf("got %v, expected nil", err)
+		}
+	})
+}
+
+func TestServer_Search(t *testing.T) {
+	server := sonictest.NewServer()
+	server.ConfigureStart("search", 20000)
+	server.On(`^QUERY collection bucket "term"$`).
+		Send("PENDING z98uDE0f").
+		Send("EVENT QUERY z98uDE0f article:one article:two")
+
+	search := sonic.NewSearch(sonic.Options{
+		Password: "password",
+		Dialer:   server.Dialer(),
+	})
+
+	server.Run(t, func(t *testing.T, _ net.Conn) {
+		defer search.Close()
+
+		res, err := search.Query(sonic.QueryRequest{
+			Collection: "collection",
+			Bucket:     "bucket",
+			Terms:      "term",
+		})
+		if err != nil {
+			t.Fatalf("got %v, expected nil", err)
+		}
+
+		if len(res) != 2 || res[0] != "article:one" || res[1] != "article:two" {
+			t.Errorf("got %v, expected [article:one article:two]", res)
+		}
+	})
+}
+
+func TestServer_Unmatched(t *testing.T) {
+	server := sonictest.NewServer()
+	server.ConfigureStart("control", 20000)
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		control := sonic.NewControl(sonic.Options{
+			Password: "password",
+			Dialer:   sonictest.Dialer(conn),
+		})
+		defer control.Close()
+
+		err := control.Consolidate()
+
+		var se *sonic.SonicError
+		if !errors.As(err, &se) {
+			t.Errorf("got %v, expected a sonic error", err)
+		}
+	})
+}
+
+func TestServer_Close(t *testing.T) {
+	server := sonictest.NewServer()
+	server.ConfigureStart("control", 20000)
+	server.On("^PING$").Send("PONG")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		control := sonic.NewControl(sonic.Options{
+			Password: "password",
+			Dialer:   sonictest.Dialer(conn),
+		})
+		defer control.Close()
+
+		if err := control.Ping(); err != nil {
+			t.Fatalf("got %v, expected nil", err)
+		}
+
+		server.Close()
+
+		if err := control.Ping(); err == nil {
+			t.Error("got nil, expected an error")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package sonic
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// PushWriter represents an io.Writer that pushes each written line to the index
+// as a separate object
+type PushWriter struct {
+	ingest     *Ingest
+	collection string
+	bucket     string
+	objectFn   func(line int) string
+	line       int
+	buf        []byte
+}
+
+// NewPushWriter returns a writer that pushes each line to the specified
+// collection and bucket. Object identifiers are returned by objectFn for each
+// line number, starting at 1, or are the line number if objectFn is nil.
+// Empty lines are skipped, but are counted so that line numbers match the input.
+func (i *Ingest) NewPushWriter(coll, bucket string, objectFn func(line int) string) *PushWriter {
+	if objectFn == nil {
+		objectFn = strconv.Itoa
+	}
+
+	return &PushWriter{
+		ingest:     i,
+		collection: coll,
+		bucket:     bucket,
+		objectFn:   objectFn,
+	}
+}
+
+// Write pushes each complete line, buffering any trailing partial line until
+// it is completed by a subsequent write or the writer is closed. If a push
+// fails, the returned count excludes the failed line so that the remaining
+// bytes can be written again.
+func (w *PushWriter) Write(p []byte) (int, error) {
+	var n int
+	for {
+		i := bytes.IndexByte(p[n:], '\n')
+		if i < 0 {
+			break
+		}
+
+		l := len(w.buf)
+		w.buf = append(w.buf, p[n:n+i]...)
+
+		if err := w.flush(); err != nil {
+			w.buf = w.buf[:l]
+			return n, err
+		}
+
+		n += i + 1
+	}
+
+	w.buf = append(w.buf, p[n:]...)
+	return len(p), nil
+}
+
+// Close pushes any buffered partial line. It does not close the ingest client.
+func (w *PushWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	return w.flush()
+}
+
+func (w *PushWriter) flush() error {
+	text := strings.TrimSuffix(string(w.buf), "\r")
+	if text != "" {
+		err := w.ingest.Push(PushRequest{
+			Collection: w.collection,
+			Bucket:     w.bucket,
+			Object:     w.objectFn(w.line + 1),
+			Text:       text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.line++
+	w.buf = w.buf[:0]
+	return nil
+}
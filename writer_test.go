@@ -0,0 +1,148 @@
+package sonic_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stevecallear/sonic"
+)
+
+func TestPushWriter_Write(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*Server)
+		objectFn func(int) string
+		writes   []string
+		n        int
+		err      error
+	}{
+		{
+			name: "should push each line",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket 1 "first"$`).Send("OK")
+				s.On(`^PUSH collection bucket 2 "second"$`).Send("OK")
+				s.On(`^PUSH collection bucket 3 "third"$`).Send("OK")
+			},
+			writes: []string{"first\nsecond\r\nthird\n"},
+			n:      20,
+		},
+		{
+			name: "should count empty lines",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket 2 "second"$`).Send("OK")
+				s.On(`^PUSH collection bucket 5 "fifth"$`).Send("OK")
+			},
+			writes: []string{"\nsecond\n\r\n", "\nfifth\n"},
+			n:      7,
+		},
+		{
+			name: "should push lines split across writes",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket 1 "first line"$`).Send("OK")
+				s.On(`^PUSH collection bucket 2 "second line"$`).Send("OK")
+			},
+			writes: []string{"fir", "st li", "ne\nsecond", " line\n"},
+			n:      6,
+		},
+		{
+			name: "should push the partial line on close",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket 1 "first"$`).Send("OK")
+				s.On(`^PUSH collection bucket 2 "partial"$`).Send("OK")
+			},
+			writes: []string{"first\npar", "tial"},
+			n:      4,
+		},
+		{
+			name: "should use the object func",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket line:1 "first"$`).Send("OK")
+			},
+			objectFn: func(n int) string {
+				return fmt.Sprintf("line:%d", n)
+			},
+			writes: []string{"first\n"},
+			n:      6,
+		},
+		{
+			name: "should return push errors",
+			setup: func(s *Server) {
+				s.ConfigureStart("ingest", 20000)
+				s.On(`^PUSH collection bucket 1 "first"$`).Send("OK")
+				s.On(`^PUSH collection bucket 2 "second"$`).Send("ERR PUSH")
+			},
+			writes: []string{"first\nsecond\nthird\n"},
+			n:      6,
+			err:    &sonic.SonicError{Code: "PUSH"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer()
+			tt.setup(server)
+
+			server.Run(t, func(t *testing.T, conn net.Conn) {
+				restore := SetDialTCP(func(string) (net.Conn, error) {
+					return conn, nil
+				})
+				defer restore()
+
+				ingest := sonic.NewIngest(sonic.Options{
+					Password: "password",
+				})
+				defer ingest.Close()
+
+				w := ingest.NewPushWriter("collection", "bucket", tt.objectFn)
+
+				var n int
+				var err error
+				for _, s := range tt.writes {
+					if n, err = w.Write([]byte(s)); err != nil {
+						break
+					}
+				}
+
+				AssertEqual(t, n, tt.n)
+				AssertError(t, err, tt.err)
+
+				if tt.err == nil {
+					AssertError(t, w.Close(), nil)
+				}
+			})
+		})
+	}
+}
+
+func TestPushWriter_Copy(t *testing.T) {
+	server := NewServer()
+	server.ConfigureStart("ingest", 20000)
+	server.On(`^PUSH collection bucket 1 "first"$`).Send("OK")
+	server.On(`^PUSH collection bucket 2 "second"$`).Send("OK")
+
+	server.Run(t, func(t *testing.T, conn net.Conn) {
+		restore := SetDialTCP(func(string) (net.Conn, error) {
+			return conn, nil
+		})
+		defer restore()
+
+		ingest := sonic.NewIngest(sonic.Options{
+			Password: "password",
+		})
+		defer ingest.Close()
+
+		w := ingest.NewPushWriter("collection", "bucket", nil)
+
+		_, err := io.Copy(w, strings.NewReader("first\nsecond"))
+		AssertError(t, err, nil)
+		AssertError(t, w.Close(), nil)
+	})
+}